@@ -0,0 +1,80 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sessions
+
+import (
+	"sync"
+	"unsafe"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// The middlewares hand their sessions to the handlers through bindings
+// rather than the keys of the RequestContext, whose map Hertz allocates
+// again for every request: requests whose handlers don't use the sessions
+// then allocate nothing.
+
+type bindingKey struct {
+	c   *app.RequestContext
+	key string
+}
+
+type bindingShard struct {
+	mu sync.Mutex
+	m  map[bindingKey]interface{}
+}
+
+var bindings [64]bindingShard
+
+func shardOf(c *app.RequestContext) *bindingShard {
+	return &bindings[(uintptr(unsafe.Pointer(c))>>8)%uintptr(len(bindings))]
+}
+
+// bind hands v to the handlers of c under key until unbind is called.
+func bind(c *app.RequestContext, key string, v interface{}) {
+	b := shardOf(c)
+	b.mu.Lock()
+	if b.m == nil {
+		b.m = make(map[bindingKey]interface{})
+	}
+	b.m[bindingKey{c, key}] = v
+	b.mu.Unlock()
+}
+
+func unbind(c *app.RequestContext, key string) {
+	b := shardOf(c)
+	b.mu.Lock()
+	delete(b.m, bindingKey{c, key})
+	b.mu.Unlock()
+}
+
+// bound returns the value bound to c under key. It is then also set in the
+// keys of c, so that c.Get and the copies of c made afterwards see it.
+func bound(c *app.RequestContext, key string) interface{} {
+	if v, ok := c.Get(key); ok {
+		return v
+	}
+	b := shardOf(c)
+	b.mu.Lock()
+	v, ok := b.m[bindingKey{c, key}]
+	b.mu.Unlock()
+	if !ok {
+		return c.MustGet(key)
+	}
+	c.Set(key, v)
+	return v
+}
@@ -0,0 +1,492 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package boltstore
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	hs "github.com/hertz-contrib/sessions"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Amount of time for cookies to expire.
+var sessionExpire = 86400 * 30
+
+// removeBatch bounds the number of records deleted by a write transaction
+// of the janitor, so that it doesn't hold the write lock for long.
+const removeBatch = 1000
+
+// compactTxSize bounds the size of the write transactions of a compaction,
+// as the bbolt compact command does.
+const compactTxSize = 65536
+
+// ErrNotCompactable is returned by Compact for a store whose database it did
+// not open, see NewStore.
+var ErrNotCompactable = errors.New("boltstore: only the database opened by NewStore can be compacted")
+
+// Store stores sessions in a bucket of an embedded bbolt database, a single
+// local file. Only the securecookie-encoded session ID is sent to the client.
+//
+// Each record holds its expiration time, so expired sessions are ignored when
+// read and deleted by a background janitor, whose freed pages are reused by
+// the following writes. The database file only shrinks when compacted, see
+// SetCompactInterval.
+type Store struct {
+	DB            *bolt.DB
+	Codecs        []securecookie.Codec
+	Opts          *sessions.Options // default configuration
+	DefaultMaxAge int               // default TTL for a MaxAge == 0 session
+	maxLength     int
+	maxLifetime   int
+	bucket        []byte
+	serializer    hs.Serializer
+	ownDB         bool
+
+	// dbMu guards DB against its swap by Compact, and writeMu holds the
+	// writes back while Compact copies the database.
+	dbMu        sync.RWMutex
+	writeMu     sync.RWMutex
+	stopCompact chan struct{}
+
+	done chan struct{}
+	once sync.Once
+}
+
+func (s *Store) Options(options hs.Options) {
+	s.Opts = options.ToGorillaOptions()
+	s.maxLifetime = options.MaxLifetime
+}
+
+// NewStore opens, or creates, the database file at path and returns a new
+// boltstore.Store which removes expired sessions every minute.
+// Close closes the database.
+func NewStore(path string, kvs ...[]byte) (*Store, error) {
+	db, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewStoreWithDB(db, time.Minute, kvs...)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	s.ownDB = true
+	return s, nil
+}
+
+// NewStoreWithDB returns a new boltstore.Store storing the sessions in the
+// bucket "sessions" of db, whose janitor removes expired sessions every
+// interval. If interval <= 0 no janitor is started and expired sessions are
+// only ignored when they are read. The database is left open by Close.
+func NewStoreWithDB(db *bolt.DB, interval time.Duration, kvs ...[]byte) (*Store, error) {
+	s := &Store{
+		DB:     db,
+		Codecs: securecookie.CodecsFromPairs(kvs...),
+		Opts: &sessions.Options{
+			Path:   "/",
+			MaxAge: sessionExpire,
+		},
+		DefaultMaxAge: 60 * 20, // 20 minutes seems like a reasonable default
+		maxLength:     4096,
+		bucket:        []byte("sessions"),
+		serializer:    hs.GobSerializer{},
+		done:          make(chan struct{}),
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(s.bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go s.janitor(interval)
+	}
+	return s, nil
+}
+
+func open(path string) (*bolt.DB, error) {
+	return bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+}
+
+// Close stops the janitor of the store, and closes the database opened by NewStore.
+func (s *Store) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		// wait for a running compaction
+		s.writeMu.Lock()
+		defer s.writeMu.Unlock()
+		s.dbMu.Lock()
+		defer s.dbMu.Unlock()
+		if s.ownDB {
+			err = s.DB.Close()
+		}
+	})
+	return err
+}
+
+// SetMaxLength sets Store.maxLength if the `l` argument is greater or equal 0
+// maxLength restricts the maximum length of new sessions to l.
+// If l is 0 there is no limit to the size of a session, use with caution.
+// The default is 4096.
+func (s *Store) SetMaxLength(l int) {
+	if l >= 0 {
+		s.maxLength = l
+	}
+}
+
+// SetCompactInterval runs Compact every interval, so that the space freed by
+// the removed sessions returns to the file system. If interval <= 0, the
+// periodic compaction is stopped.
+// Once the store compacts its database, Store.DB must not be used directly,
+// as the database is reopened.
+func (s *Store) SetCompactInterval(interval time.Duration) {
+	if !s.ownDB {
+		hlog.Warnf("boltstore: compaction not enabled: %v", ErrNotCompactable)
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.stopCompact != nil {
+		close(s.stopCompact)
+		s.stopCompact = nil
+	}
+	if interval > 0 {
+		s.stopCompact = make(chan struct{})
+		go s.compactor(interval, s.stopCompact)
+	}
+}
+
+// SetSerializer sets the serializer
+func (s *Store) SetSerializer(ss hs.Serializer) {
+	s.serializer = ss
+}
+
+// SetMaxAge restricts the maximum age, in seconds, of the session record
+// and the cookie.
+//
+// See RediStore.SetMaxAge.
+func (s *Store) SetMaxAge(v int) {
+	s.Opts.MaxAge = v
+	hs.SetCodecsMaxAge(s.Codecs, v)
+}
+
+// SetMaxLifetime caps the lifetime, in seconds, of the sessions of the store
+// counted from their creation regardless of activity. Older sessions are
+// deleted and treated as new. Set it to 0 for no restriction.
+func (s *Store) SetMaxLifetime(v int) {
+	s.maxLifetime = v
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	var (
+		err error
+		ok  bool
+	)
+	session := sessions.NewSession(s, name)
+	// make a copy
+	options := *s.Opts
+	session.Options = &options
+	session.IsNew = true
+	if c, errCookie := r.Cookie(name); errCookie == nil {
+		err = hs.DecodeCookie(r.Context(), name, c.Value, &session.ID, s.Codecs...)
+		if err == nil {
+			ok, err = s.load(session)
+			session.IsNew = !(err == nil && ok) // not new if no error and data available
+		}
+	}
+	if err == nil && hs.LifetimeExceeded(session, s.maxLifetime) {
+		// The session outlived its absolute lifetime, start over.
+		err = s.delete(session)
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+	}
+	if s.maxLifetime > 0 {
+		hs.StampCreated(session)
+	}
+	return session, err
+}
+
+// Save adds a single session to the response.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	// Marked for deletion.
+	if session.Options.MaxAge < 0 {
+		if err := s.delete(session); err != nil {
+			return err
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	if err := s.save(session); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Regenerate removes the session record and clears the session ID,
+// so that the next Save stores the values under a fresh ID.
+func (s *Store) Regenerate(r *http.Request, session *sessions.Session) error {
+	if err := s.delete(session); err != nil {
+		return err
+	}
+	session.ID = ""
+	return nil
+}
+
+// age returns the TTL of the session.
+func (s *Store) age(session *sessions.Session) time.Duration {
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	return time.Duration(age) * time.Second
+}
+
+// save stores the serialized session, prefixed by its expiration time.
+func (s *Store) save(session *sessions.Session) error {
+	b, err := s.serializer.Serialize(session)
+	if err != nil {
+		return err
+	}
+	if s.maxLength != 0 && len(b) > s.maxLength {
+		return errors.New("boltstore: the value to store is too big")
+	}
+	record := make([]byte, 8+len(b))
+	binary.BigEndian.PutUint64(record, uint64(time.Now().Add(s.age(session)).UnixNano()))
+	copy(record[8:], b)
+	return s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Put([]byte(session.ID), record)
+	})
+}
+
+// load reads the session record into the session.
+// returns true if there is a live session record
+func (s *Store) load(session *sessions.Session) (bool, error) {
+	var b []byte
+	err := s.view(func(tx *bolt.Tx) error {
+		record := tx.Bucket(s.bucket).Get([]byte(session.ID))
+		if len(record) < 8 || expired(record, time.Now()) {
+			return nil
+		}
+		// the record is only valid during the transaction
+		b = append([]byte(nil), record[8:]...)
+		return nil
+	})
+	if err != nil {
+		return false, hs.Unavailable(err)
+	}
+	if b == nil {
+		return false, nil // no data was associated with this key
+	}
+	return true, s.serializer.Deserialize(b, session)
+}
+
+// delete removes the session record.
+func (s *Store) delete(session *sessions.Session) error {
+	if session.ID == "" {
+		return nil
+	}
+	return s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(s.bucket).Delete([]byte(session.ID))
+	})
+}
+
+// view runs a read-only transaction on the database.
+func (s *Store) view(fn func(*bolt.Tx) error) error {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	return s.DB.View(fn)
+}
+
+// update runs a read-write transaction on the database once it is not being
+// compacted.
+func (s *Store) update(fn func(*bolt.Tx) error) error {
+	s.writeMu.RLock()
+	defer s.writeMu.RUnlock()
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+	return s.DB.Update(fn)
+}
+
+func expired(record []byte, now time.Time) bool {
+	return int64(binary.BigEndian.Uint64(record)) <= now.UnixNano()
+}
+
+// janitor periodically removes expired session records until the store is closed.
+func (s *Store) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.removeExpired(); err != nil {
+				hlog.Warnf("boltstore: remove expired sessions: %v", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// removeExpired deletes all expired session records, a batch per
+// transaction, each scan resuming after the last key of the previous one.
+func (s *Store) removeExpired() error {
+	var last []byte
+	for {
+		var ids [][]byte
+		end := true
+		now := time.Now()
+		err := s.view(func(tx *bolt.Tx) error {
+			c := tx.Bucket(s.bucket).Cursor()
+			k, v := c.First()
+			if last != nil {
+				if k, v = c.Seek(last); bytes.Equal(k, last) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil; k, v = c.Next() {
+				if len(ids) == removeBatch {
+					end = false
+					break
+				}
+				if len(v) < 8 || expired(v, now) {
+					ids = append(ids, append([]byte(nil), k...))
+				}
+				last = append(last[:0], k...)
+			}
+			return nil
+		})
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		err = s.update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(s.bucket)
+			for _, id := range ids {
+				// the session may have been saved again meanwhile
+				if v := b.Get(id); v != nil && (len(v) < 8 || expired(v, now)) {
+					if err := b.Delete(id); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil || end {
+			return err
+		}
+	}
+}
+
+// compactor periodically compacts the database until stopped or the store is closed.
+func (s *Store) compactor(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Compact(); err != nil {
+				hlog.Warnf("boltstore: compact database: %v", err)
+			}
+		case <-stop:
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Compact copies the live pages of the database into a new file, which then
+// replaces the database file. Writes wait for the copy, and all accesses for
+// the swap of the files. It returns ErrNotCompactable unless the database was
+// opened by NewStore.
+func (s *Store) Compact() error {
+	if !s.ownDB {
+		return ErrNotCompactable
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	select {
+	case <-s.done:
+		return bolt.ErrDatabaseNotOpen
+	default:
+	}
+	path := s.DB.Path()
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".compact-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	dst, err := open(tmp)
+	if err == nil {
+		// the reads go on during the copy
+		err = bolt.Compact(dst, s.DB, compactTxSize)
+		if cerr := dst.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+	if err = s.DB.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		os.Remove(tmp)
+	}
+	// reopen the database, compacted or not
+	db, oerr := open(path)
+	if oerr != nil {
+		return oerr
+	}
+	s.DB = db
+	return err
+}
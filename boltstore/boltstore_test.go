@@ -0,0 +1,224 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package boltstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/hertz-contrib/sessions"
+	"github.com/hertz-contrib/sessions/tester"
+	bolt "go.etcd.io/bbolt"
+)
+
+var newStore = func(t *testing.T) sessions.Store {
+	store, err := NewStore(filepath.Join(t.TempDir(), "sessions.db"), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestBolt_SessionGetSet(t *testing.T) {
+	tester.GetSet(t, newStore)
+}
+
+func TestBolt_SessionDeleteKey(t *testing.T) {
+	tester.DeleteKey(t, newStore)
+}
+
+func TestBolt_SessionFlashes(t *testing.T) {
+	tester.Flashes(t, newStore)
+}
+
+func TestBolt_SessionClear(t *testing.T) {
+	tester.Clear(t, newStore)
+}
+
+func TestBolt_SessionOptions(t *testing.T) {
+	tester.Options(t, newStore)
+}
+
+func TestBolt_SessionMany(t *testing.T) {
+	tester.Many(t, newStore)
+}
+
+func TestBolt_SessionRegenerate(t *testing.T) {
+	tester.Regenerate(t, newStore)
+}
+
+func TestBolt_SessionMaxLifetime(t *testing.T) {
+	tester.MaxLifetime(t, newStore)
+}
+
+func TestBolt_SessionAutoSave(t *testing.T) {
+	tester.AutoSave(t, newStore)
+}
+
+func TestBolt_SessionContextKey(t *testing.T) {
+	tester.ContextKey(t, newStore)
+}
+
+func TestBolt_SessionInvalidCookie(t *testing.T) {
+	tester.InvalidCookie(t, newStore)
+}
+
+func TestBolt_SessionGetAs(t *testing.T) {
+	tester.GetAs(t, newStore)
+	tester.GetAs(t, func(t *testing.T) sessions.Store {
+		store := newStore(t).(*Store)
+		store.SetSerializer(sessions.JSONSerializer{})
+		return store
+	})
+}
+
+func TestBolt_SessionLazy(t *testing.T) {
+	tester.Lazy(t, newStore)
+}
+
+func TestBolt_SessionKeyRing(t *testing.T) {
+	tester.KeyRing(t, func(t *testing.T, ring *sessions.KeyRing) sessions.Store {
+		store := newStore(t).(*Store)
+		store.Codecs = ring.Codecs()
+		return store
+	})
+}
+
+func TestBolt_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := NewStore(path, []byte("secret"))
+	assert.Nil(t, err)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	assert.Nil(t, err)
+	session.Values["key"] = "val"
+	w := httptest.NewRecorder()
+	assert.Nil(t, store.Save(req, w, session))
+	assert.Nil(t, store.Close())
+
+	// the session survives a restart
+	store, err = NewStore(path, []byte("secret"))
+	assert.Nil(t, err)
+	defer store.Close()
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", w.Header().Get("Set-Cookie"))
+	session, err = store.New(req, "session-key")
+	assert.Nil(t, err)
+	assert.False(t, session.IsNew)
+	assert.DeepEqual(t, "val", session.Values["key"])
+}
+
+func TestBolt_Expiry(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "sessions.db"), 0o600, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	store, err := NewStoreWithDB(db, 10*time.Millisecond, []byte("secret"))
+	assert.Nil(t, err)
+	defer store.Close()
+	store.DefaultMaxAge = 1
+	store.Opts.MaxAge = 0
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	for i := 0; i < removeBatch+10; i++ {
+		session, err := store.New(req, "session-key")
+		assert.Nil(t, err)
+		session.Values["key"] = "val"
+		assert.Nil(t, store.Save(req, httptest.NewRecorder(), session))
+	}
+	session, err := store.New(req, "session-key")
+	assert.Nil(t, err)
+	session.Options.MaxAge = 60
+	assert.Nil(t, store.Save(req, httptest.NewRecorder(), session))
+	time.Sleep(1100 * time.Millisecond)
+
+	var n int
+	assert.Nil(t, db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(store.bucket).Stats().KeyN
+		return nil
+	}))
+	assert.DeepEqual(t, 1, n)
+	ok, err := store.load(session)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestBolt_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := NewStore(path, []byte("secret"))
+	assert.Nil(t, err)
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	kept, err := store.New(req, "session-key")
+	assert.Nil(t, err)
+	kept.Values["key"] = strings.Repeat("val", 100)
+	assert.Nil(t, store.Save(req, httptest.NewRecorder(), kept))
+	var ids []string
+	for i := 0; i < 2000; i++ {
+		session, err := store.New(req, "session-key")
+		assert.Nil(t, err)
+		session.Values["key"] = strings.Repeat("val", 100)
+		assert.Nil(t, store.Save(req, httptest.NewRecorder(), session))
+		ids = append(ids, session.ID)
+	}
+	assert.Nil(t, store.update(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			if err := tx.Bucket(store.bucket).Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	before, err := os.Stat(path)
+	assert.Nil(t, err)
+
+	// sessions are served while the database is compacted
+	store.SetCompactInterval(time.Millisecond)
+	for i := 0; i < 50; i++ {
+		ok, err := store.load(kept)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Nil(t, store.save(kept))
+	}
+	store.SetCompactInterval(0)
+
+	assert.Nil(t, store.Compact())
+	after, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.True(t, after.Size() < before.Size())
+	tmp, _ := filepath.Glob(path + ".compact-*")
+	assert.DeepEqual(t, 0, len(tmp))
+	ok, err := store.load(kept)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.DeepEqual(t, strings.Repeat("val", 100), kept.Values["key"])
+
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "other.db"), 0o600, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+	other, err := NewStoreWithDB(db, 0, []byte("secret"))
+	assert.Nil(t, err)
+	assert.DeepEqual(t, ErrNotCompactable, other.Compact())
+}
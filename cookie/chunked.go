@@ -0,0 +1,98 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cookie
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"github.com/hertz-contrib/sessions"
+)
+
+const (
+	// chunkSize keeps each cookie under the 4096 bytes browsers accept,
+	// leaving room for its name and attributes.
+	chunkSize = 3800
+	// maxChunks bounds the size of a session, as servers limit the size of
+	// the request headers.
+	maxChunks = 10
+)
+
+// NewChunkedStore returns a cookie store for sessions larger than a cookie:
+// the encoded session is split across the cookies name, name_1, name_2...,
+// up to about 38KB. Other sessions must not use names ending with _<number>.
+func NewChunkedStore(keyPairs ...[]byte) Store {
+	cs := gsessions.NewCookieStore(keyPairs...)
+	for _, codec := range cs.Codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxLength(chunkSize * maxChunks)
+		}
+	}
+	return &store{CookieStore: cs, chunked: true}
+}
+
+func chunkName(name string, i int) string {
+	if i == 0 {
+		return name
+	}
+	return name + "_" + strconv.Itoa(i)
+}
+
+// loadChunks reassembles the value of the chunks of a session.
+func loadChunks(cookies sessions.Carrier, name string) (string, bool) {
+	var value strings.Builder
+	for i := 0; i < maxChunks; i++ {
+		chunk, ok := cookies.Cookie(chunkName(name, i))
+		if !ok {
+			break
+		}
+		value.WriteString(chunk)
+	}
+	return value.String(), value.Len() > 0
+}
+
+// saveChunks writes the chunks of the session, and expires the chunks left
+// over from a larger version of it.
+func saveChunks(cookies sessions.Carrier, session *gsessions.Session, encoded string) error {
+	chunks := 0
+	if session.Options.MaxAge >= 0 {
+		chunks = (len(encoded) + chunkSize - 1) / chunkSize
+		if chunks > maxChunks {
+			return fmt.Errorf("cookie: session %s is too large: %d bytes", session.Name(), len(encoded))
+		}
+		for i := 0; i < chunks; i++ {
+			end := (i + 1) * chunkSize
+			if end > len(encoded) {
+				end = len(encoded)
+			}
+			cookies.SetCookie(gsessions.NewCookie(chunkName(session.Name(), i), encoded[i*chunkSize:end], session.Options))
+		}
+	}
+	expired := *session.Options
+	expired.MaxAge = -1
+	for i := chunks; i < maxChunks; i++ {
+		// the first cookie is always expired when deleting the session
+		if _, ok := cookies.Cookie(chunkName(session.Name(), i)); !ok && i > 0 {
+			break
+		}
+		cookies.SetCookie(gsessions.NewCookie(chunkName(session.Name(), i), "", &expired))
+	}
+	return nil
+}
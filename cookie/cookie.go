@@ -41,6 +41,11 @@
 package cookie
 
 import (
+	"context"
+	"net/http"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/gorilla/securecookie"
 	gsessions "github.com/gorilla/sessions"
 	"github.com/hertz-contrib/sessions"
 )
@@ -51,12 +56,93 @@ type Store interface {
 
 type store struct {
 	*gsessions.CookieStore
+	maxLifetime int
+	chunked     bool
 }
 
 func (c *store) Options(opts sessions.Options) {
 	c.CookieStore.Options = opts.ToGorillaOptions()
+	c.maxLifetime = opts.MaxLifetime
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (c *store) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(c, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+// Sessions older than Options.MaxLifetime are discarded.
+func (c *store) New(r *http.Request, name string) (*gsessions.Session, error) {
+	return c.load(r.Context(), sessions.HTTPCarrier(r, nil), name)
+}
+
+// Save adds a single session to the response.
+func (c *store) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	return c.save(sessions.HTTPCarrier(r, w), session)
+}
+
+// GetHertz returns a session for the given name, read from the Hertz request.
+func (c *store) GetHertz(ctx context.Context, rc *app.RequestContext, name string) (*gsessions.Session, error) {
+	return c.load(ctx, sessions.HertzCarrier(rc), name)
+}
+
+// SaveHertz adds a single session to the Hertz response.
+func (c *store) SaveHertz(_ context.Context, rc *app.RequestContext, session *gsessions.Session) error {
+	return c.save(sessions.HertzCarrier(rc), session)
+}
+
+// load decodes the session from its cookie, or its chunks.
+func (c *store) load(ctx context.Context, cookies sessions.Carrier, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(c, name)
+	opts := *c.CookieStore.Options
+	session.Options = &opts
+	session.IsNew = true
+	var err error
+	if value, ok := c.cookie(cookies, name); ok {
+		err = sessions.DecodeCookie(ctx, name, value, &session.Values, c.Codecs...)
+		if err == nil {
+			session.IsNew = false
+		}
+	}
+	if err == nil && sessions.LifetimeExceeded(session, c.maxLifetime) {
+		// The session outlived its absolute lifetime, start over.
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+	}
+	if c.maxLifetime > 0 {
+		sessions.StampCreated(session)
+	}
+	return session, err
+}
+
+// save encodes the session into its cookie, or its chunks.
+func (c *store) save(cookies sessions.Carrier, session *gsessions.Session) error {
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.Values, c.Codecs...)
+	if err != nil {
+		return err
+	}
+	if c.chunked {
+		return saveChunks(cookies, session, encoded)
+	}
+	cookies.SetCookie(gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+func (c *store) cookie(cookies sessions.Carrier, name string) (string, bool) {
+	if c.chunked {
+		return loadChunks(cookies, name)
+	}
+	return cookies.Cookie(name)
 }
 
 func NewStore(keyPairs ...[]byte) Store {
-	return &store{gsessions.NewCookieStore(keyPairs...)}
+	return &store{CookieStore: gsessions.NewCookieStore(keyPairs...)}
+}
+
+// NewStoreWithKeyRing returns a cookie store encoding the cookies with the
+// keys of ring, which can be rotated at runtime.
+func NewStoreWithKeyRing(ring *sessions.KeyRing) Store {
+	cs := gsessions.NewCookieStore()
+	cs.Codecs = ring.Codecs()
+	return &store{CookieStore: cs}
 }
@@ -41,8 +41,24 @@
 package cookie
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/adaptor"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
 	"github.com/hertz-contrib/sessions"
 	"github.com/hertz-contrib/sessions/tester"
 )
@@ -75,3 +91,294 @@ func TestCookie_SessionOptions(t *testing.T) {
 func TestCookie_SessionMany(t *testing.T) {
 	tester.Many(t, newStore)
 }
+
+func TestCookie_SessionRegenerate(t *testing.T) {
+	tester.Regenerate(t, newStore)
+}
+
+func TestCookie_SessionMaxLifetime(t *testing.T) {
+	tester.MaxLifetime(t, newStore)
+}
+
+func TestCookie_SessionAutoSave(t *testing.T) {
+	tester.AutoSave(t, newStore)
+}
+
+func TestCookie_SessionContextKey(t *testing.T) {
+	tester.ContextKey(t, newStore)
+}
+
+func TestCookie_SessionInvalidCookie(t *testing.T) {
+	tester.InvalidCookie(t, newStore)
+}
+
+func TestCookie_SessionGetAs(t *testing.T) {
+	tester.GetAs(t, newStore)
+}
+
+var newChunkedStore = func(_ *testing.T) sessions.Store {
+	return NewChunkedStore([]byte("secret"))
+}
+
+func TestChunked_SessionGetSet(t *testing.T) {
+	tester.GetSet(t, newChunkedStore)
+}
+
+func TestChunked_SessionDeleteKey(t *testing.T) {
+	tester.DeleteKey(t, newChunkedStore)
+}
+
+func TestChunked_SessionFlashes(t *testing.T) {
+	tester.Flashes(t, newChunkedStore)
+}
+
+func TestChunked_SessionClear(t *testing.T) {
+	tester.Clear(t, newChunkedStore)
+}
+
+func TestChunked_SessionOptions(t *testing.T) {
+	tester.Options(t, newChunkedStore)
+}
+
+func TestChunked_SessionMany(t *testing.T) {
+	tester.Many(t, newChunkedStore)
+}
+
+func TestChunked_SessionRegenerate(t *testing.T) {
+	tester.Regenerate(t, newChunkedStore)
+}
+
+func TestChunked_SessionMaxLifetime(t *testing.T) {
+	tester.MaxLifetime(t, newChunkedStore)
+}
+
+func TestChunked_SessionAutoSave(t *testing.T) {
+	tester.AutoSave(t, newChunkedStore)
+}
+
+func TestChunked_SessionContextKey(t *testing.T) {
+	tester.ContextKey(t, newChunkedStore)
+}
+
+func TestChunked_SessionInvalidCookie(t *testing.T) {
+	tester.InvalidCookie(t, newChunkedStore)
+}
+
+func TestChunked_SessionGetAs(t *testing.T) {
+	tester.GetAs(t, newChunkedStore)
+}
+
+func TestChunked_SessionNative(t *testing.T) {
+	tester.Native(t, newChunkedStore)
+}
+
+func TestChunked_LargeSession(t *testing.T) {
+	large := strings.Repeat("0123456789abcdef", 1000)
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	r.Use(sessions.New("mysession", NewChunkedStore([]byte("secret"))))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		session.Set("large", large)
+		_ = session.Save()
+		c.String(consts.StatusOK, "ok")
+	})
+	r.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if session.Get("large") != large {
+			t.Error("Large session was not reassembled")
+		}
+		c.String(consts.StatusOK, "ok")
+	})
+	r.GET("/shrink", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		session.Set("large", "small")
+		_ = session.Save()
+		c.String(consts.StatusOK, "ok")
+	})
+	r.GET("/huge", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		session.Set("large", strings.Repeat(large, 4))
+		if err := session.Save(); err == nil {
+			t.Error("Expected error saving a session over the chunk limit")
+		}
+		c.String(consts.StatusOK, "ok")
+	})
+
+	cookies := func(w *ut.ResponseRecorder) []*http.Cookie {
+		resp := http.Response{Header: adaptor.GetCompatResponseWriter(w.Result()).Header()}
+		return resp.Cookies()
+	}
+	header := func(cs []*http.Cookie) ut.Header {
+		pairs := make([]string, 0, len(cs))
+		for _, c := range cs {
+			pairs = append(pairs, c.Name+"="+c.Value)
+			if len(c.Value) > 4000 {
+				t.Errorf("Cookie %s is too large: %d bytes", c.Name, len(c.Value))
+			}
+		}
+		return ut.Header{Key: "Cookie", Value: strings.Join(pairs, "; ")}
+	}
+
+	set := cookies(ut.PerformRequest(r, consts.MethodGet, "/set", nil))
+	if len(set) < 2 || set[0].Name != "mysession" || set[1].Name != "mysession_1" {
+		t.Fatalf("Expected the session to be split across cookies; Got %v", set)
+	}
+	_ = ut.PerformRequest(r, consts.MethodGet, "/get", nil, header(set))
+
+	shrunk := cookies(ut.PerformRequest(r, consts.MethodGet, "/shrink", nil, header(set)))
+	if len(shrunk) != len(set) {
+		t.Fatalf("Expected %d cookies; Got %v", len(set), shrunk)
+	}
+	for _, c := range shrunk[1:] {
+		if c.Expires.After(time.Now()) {
+			t.Errorf("Expected stale chunk %s to be expired", c.Name)
+		}
+	}
+	_ = ut.PerformRequest(r, consts.MethodGet, "/huge", nil)
+}
+
+func TestCookie_SessionLazy(t *testing.T) {
+	tester.Lazy(t, newStore)
+}
+
+func TestCookie_SessionNative(t *testing.T) {
+	tester.Native(t, newStore)
+}
+
+func TestCookie_SessionKeyRing(t *testing.T) {
+	tester.KeyRing(t, func(_ *testing.T, ring *sessions.KeyRing) sessions.Store {
+		return NewStoreWithKeyRing(ring)
+	})
+}
+
+func TestCookie_KeyRingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	writeKeys := func(keys ...sessions.Key) {
+		b, err := json.Marshal(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(path, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldKey := sessions.Key{ID: "old", HashKey: []byte("old-hash-key")}
+	newKey := sessions.Key{ID: "new", HashKey: []byte("new-hash-key")}
+	writeKeys(oldKey)
+
+	ring, err := sessions.LoadKeyRing(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.Close()
+	ring.Watch(path, 10*time.Millisecond)
+
+	encoded, err := ring.Encode("mysession", "value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeKeys(newKey, oldKey)
+	// make sure the change is seen even on coarse file systems
+	_ = os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	deadline := time.Now().Add(2 * time.Second)
+	for ring.IDs()[0] != "new" {
+		if time.Now().After(deadline) {
+			t.Fatal("Key file change was not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var value string
+	if id, err := ring.DecodeKey("mysession", encoded, &value); err != nil || id != "old" || value != "value" {
+		t.Errorf("Expected value decoded by the old key; Got %q %q %v", value, id, err)
+	}
+	if encoded, err = ring.Encode("mysession", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := ring.DecodeKey("mysession", encoded, &value); err != nil || id != "new" {
+		t.Errorf("Expected value encoded with the new key; Got %q %v", id, err)
+	}
+
+	// a broken key file keeps the keys in use
+	logs := &syncBuffer{}
+	hlog.SetOutput(logs)
+	defer hlog.SetOutput(os.Stderr)
+	if err = os.WriteFile(path, []byte("not json"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(path, time.Now().Add(2*time.Second), time.Now().Add(2*time.Second))
+	// wait until the watcher failed to reload the file
+	deadline = time.Now().Add(2 * time.Second)
+	for !strings.Contains(logs.String(), "reload key file") {
+		if time.Now().After(deadline) {
+			t.Fatal("Broken key file was not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ids := ring.IDs(); len(ids) != 2 || ids[0] != "new" {
+		t.Errorf("Expected the keys to be kept; Got %v", ids)
+	}
+
+	if _, err = sessions.NewKeyRing(); err == nil {
+		t.Error("Expected error for an empty key ring")
+	}
+	if _, err = sessions.NewKeyRing(oldKey, oldKey); err == nil {
+		t.Error("Expected error for duplicate key IDs")
+	}
+}
+
+// syncBuffer collects the logs of the key ring watcher.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func benchmarkMiddleware(b *testing.B, handlers ...app.HandlerFunc) {
+	ctx := context.Background()
+	c := app.NewContext(0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.ResetWithoutConn()
+		c.SetHandlers(handlers)
+		c.Next(ctx)
+	}
+}
+
+func BenchmarkCookie_NoSession(b *testing.B) {
+	benchmarkMiddleware(b, func(ctx context.Context, c *app.RequestContext) {
+		c.SetStatusCode(consts.StatusOK)
+	})
+}
+
+// BenchmarkCookie_SessionUntouched measures the cost of the middleware on
+// routes not using the session, which must not allocate.
+func BenchmarkCookie_SessionUntouched(b *testing.B) {
+	benchmarkMiddleware(b, sessions.New("mysession", NewStore([]byte("secret"))),
+		func(ctx context.Context, c *app.RequestContext) {
+			c.SetStatusCode(consts.StatusOK)
+		})
+}
+
+func BenchmarkCookie_SessionTouched(b *testing.B) {
+	benchmarkMiddleware(b, sessions.New("mysession", NewStore([]byte("secret"))),
+		func(ctx context.Context, c *app.RequestContext) {
+			session := sessions.Default(c)
+			session.Set("key", "value")
+			_ = session.Save()
+			c.SetStatusCode(consts.StatusOK)
+		})
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sessions
+
+import (
+	"errors"
+
+	"github.com/gorilla/securecookie"
+)
+
+var (
+	// ErrInvalidCookie is matched by load errors caused by a session cookie
+	// which could not be decoded: tampered with, expired or signed with unknown keys.
+	ErrInvalidCookie = errors.New("sessions: invalid session cookie")
+	// ErrStoreUnavailable is matched by load errors caused by a store
+	// failing to reach its backend.
+	ErrStoreUnavailable = errors.New("sessions: session store unavailable")
+	// ErrSessionLimit is returned by Save when the user bound to a new
+	// session already has as many sessions as allowed, see RejectNewSession.
+	ErrSessionLimit = errors.New("sessions: too many sessions for the user")
+)
+
+// kindError tags an error with one of the errors above, for errors.Is.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Unavailable marks an error returned by a store as a failure to reach its
+// backend, so that it matches ErrStoreUnavailable.
+func Unavailable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: ErrStoreUnavailable, err: err}
+}
+
+// loadError marks cookie decoding errors returned by a store as ErrInvalidCookie.
+func loadError(err error) error {
+	var cerr securecookie.Error
+	if errors.As(err, &cerr) && cerr.IsDecode() {
+		return &kindError{kind: ErrInvalidCookie, err: err}
+	}
+	return err
+}
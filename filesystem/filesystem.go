@@ -0,0 +1,366 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filesystem
+
+import (
+	"encoding/base32"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	hs "github.com/hertz-contrib/sessions"
+)
+
+// Amount of time for cookies to expire.
+var sessionExpire = 86400 * 30
+
+const (
+	filePrefix = "session_"
+	tempSuffix = ".tmp"
+	// tempGrace is how long the cleanup keeps temporary files,
+	// which are only left over by a crash during a write.
+	tempGrace = time.Hour
+)
+
+// Store stores sessions in a directory, one file per session.
+// Only the securecookie-encoded session ID is sent to the client.
+//
+// A session file is written to a temporary file renamed over the previous
+// version, so that concurrent readers never see a partial write. Its
+// modification time is set to the expiration of the session.
+type Store struct {
+	Codecs        []securecookie.Codec
+	Opts          *sessions.Options // default configuration
+	DefaultMaxAge int               // default TTL for a MaxAge == 0 session
+	maxLength     int
+	maxLifetime   int
+	path          string
+	temp          bool // path is a private directory created by the store
+	serializer    hs.Serializer
+
+	done chan struct{}
+	once sync.Once
+}
+
+func (s *Store) Options(options hs.Options) {
+	s.Opts = options.ToGorillaOptions()
+	s.maxLifetime = options.MaxLifetime
+}
+
+// NewStore returns a new filesystem.Store storing the sessions in the
+// directory path, created if needed, which removes expired sessions every
+// minute. If path is empty a private directory is created under os.TempDir(),
+// and removed with the sessions it holds when the store is closed.
+func NewStore(path string, kvs ...[]byte) (*Store, error) {
+	return NewStoreWithCleanup(path, time.Minute, kvs...)
+}
+
+// NewStoreWithCleanup returns a new filesystem.Store whose janitor removes
+// expired session files every interval. If interval <= 0 no janitor is
+// started and expired session files are only ignored when they are read.
+func NewStoreWithCleanup(path string, interval time.Duration, kvs ...[]byte) (*Store, error) {
+	temp := path == ""
+	if temp {
+		// never share a directory the janitor would clean for other processes
+		dir, err := os.MkdirTemp("", "hertz-sessions-")
+		if err != nil {
+			return nil, err
+		}
+		path = dir
+	} else if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		Codecs: securecookie.CodecsFromPairs(kvs...),
+		Opts: &sessions.Options{
+			Path:   "/",
+			MaxAge: sessionExpire,
+		},
+		DefaultMaxAge: 60 * 20, // 20 minutes seems like a reasonable default
+		maxLength:     4096,
+		path:          path,
+		temp:          temp,
+		serializer:    hs.GobSerializer{},
+		done:          make(chan struct{}),
+	}
+	if interval > 0 {
+		go s.janitor(interval)
+	}
+	return s, nil
+}
+
+// Close stops the janitor of the store, and removes the directory of the
+// sessions if the store created it.
+func (s *Store) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		if s.temp {
+			err = os.RemoveAll(s.path)
+		}
+	})
+	return err
+}
+
+// SetMaxLength sets Store.maxLength if the `l` argument is greater or equal 0
+// maxLength restricts the maximum length of new sessions to l.
+// If l is 0 there is no limit to the size of a session, use with caution.
+// The default is 4096.
+func (s *Store) SetMaxLength(l int) {
+	if l >= 0 {
+		s.maxLength = l
+	}
+}
+
+// SetSerializer sets the serializer
+func (s *Store) SetSerializer(ss hs.Serializer) {
+	s.serializer = ss
+}
+
+// SetMaxAge restricts the maximum age, in seconds, of the session file
+// and the cookie.
+//
+// See RediStore.SetMaxAge.
+func (s *Store) SetMaxAge(v int) {
+	s.Opts.MaxAge = v
+	hs.SetCodecsMaxAge(s.Codecs, v)
+}
+
+// SetMaxLifetime caps the lifetime, in seconds, of the sessions of the store
+// counted from their creation regardless of activity. Older sessions are
+// deleted and treated as new. Set it to 0 for no restriction.
+func (s *Store) SetMaxLifetime(v int) {
+	s.maxLifetime = v
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	var (
+		err error
+		ok  bool
+	)
+	session := sessions.NewSession(s, name)
+	// make a copy
+	options := *s.Opts
+	session.Options = &options
+	session.IsNew = true
+	if c, errCookie := r.Cookie(name); errCookie == nil {
+		err = hs.DecodeCookie(r.Context(), name, c.Value, &session.ID, s.Codecs...)
+		if err == nil {
+			ok, err = s.load(session)
+			session.IsNew = !(err == nil && ok) // not new if no error and data available
+		}
+	}
+	if err == nil && hs.LifetimeExceeded(session, s.maxLifetime) {
+		// The session outlived its absolute lifetime, start over.
+		err = s.delete(session)
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+	}
+	if s.maxLifetime > 0 {
+		hs.StampCreated(session)
+	}
+	return session, err
+}
+
+// Save adds a single session to the response.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	// Marked for deletion.
+	if session.Options.MaxAge < 0 {
+		if err := s.delete(session); err != nil {
+			return err
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	if err := s.save(session); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Regenerate removes the session file and clears the session ID,
+// so that the next Save stores the values under a fresh ID.
+func (s *Store) Regenerate(r *http.Request, session *sessions.Session) error {
+	if err := s.delete(session); err != nil {
+		return err
+	}
+	session.ID = ""
+	return nil
+}
+
+// filename returns the path of the session file.
+func (s *Store) filename(session *sessions.Session) (string, error) {
+	// IDs are generated by the store, anything else was not written by it
+	if strings.ContainsAny(session.ID, `/\.`) {
+		return "", errors.New("filesystem: invalid session ID")
+	}
+	return filepath.Join(s.path, filePrefix+session.ID), nil
+}
+
+// age returns the TTL of the session.
+func (s *Store) age(session *sessions.Session) time.Duration {
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	return time.Duration(age) * time.Second
+}
+
+// save writes the session to a temporary file renamed over the session file.
+func (s *Store) save(session *sessions.Session) error {
+	b, err := s.serializer.Serialize(session)
+	if err != nil {
+		return err
+	}
+	if s.maxLength != 0 && len(b) > s.maxLength {
+		return errors.New("filesystem: the value to store is too big")
+	}
+	name, err := s.filename(session)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.path, filePrefix+"*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		expires := time.Now().Add(s.age(session))
+		err = os.Chtimes(tmp, expires, expires)
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// load reads the session file into the session.
+// returns true if there is a live session file
+func (s *Store) load(session *sessions.Session) (bool, error) {
+	name, err := s.filename(session)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil // no data was associated with this key
+	}
+	if err != nil {
+		return false, hs.Unavailable(err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, hs.Unavailable(err)
+	}
+	if time.Now().After(fi.ModTime()) {
+		return false, nil // expired, removed by the janitor
+	}
+	b := make([]byte, fi.Size())
+	if _, err = f.ReadAt(b, 0); err != nil {
+		return false, hs.Unavailable(err)
+	}
+	return true, s.serializer.Deserialize(b, session)
+}
+
+// delete removes the session file.
+func (s *Store) delete(session *sessions.Session) error {
+	if session.ID == "" {
+		return nil
+	}
+	name, err := s.filename(session)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// janitor periodically removes expired session files until the store is closed.
+func (s *Store) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.cleanup(); err != nil {
+				hlog.Warnf("filesystem: cleanup %s: %v", s.path, err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// cleanup removes all expired session files, and the temporary files left
+// over by interrupted writes.
+func (s *Store) cleanup() error {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), filePrefix) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue // removed meanwhile
+		}
+		expires := fi.ModTime()
+		if strings.HasSuffix(e.Name(), tempSuffix) {
+			expires = expires.Add(tempGrace)
+		}
+		if now.After(expires) {
+			_ = os.Remove(filepath.Join(s.path, e.Name()))
+		}
+	}
+	return nil
+}
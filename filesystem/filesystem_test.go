@@ -0,0 +1,162 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filesystem
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/hertz-contrib/sessions"
+	"github.com/hertz-contrib/sessions/tester"
+)
+
+var newStore = func(t *testing.T) sessions.Store {
+	store, err := NewStore(t.TempDir(), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestFilesystem_SessionGetSet(t *testing.T) {
+	tester.GetSet(t, newStore)
+}
+
+func TestFilesystem_SessionDeleteKey(t *testing.T) {
+	tester.DeleteKey(t, newStore)
+}
+
+func TestFilesystem_SessionFlashes(t *testing.T) {
+	tester.Flashes(t, newStore)
+}
+
+func TestFilesystem_SessionClear(t *testing.T) {
+	tester.Clear(t, newStore)
+}
+
+func TestFilesystem_SessionOptions(t *testing.T) {
+	tester.Options(t, newStore)
+}
+
+func TestFilesystem_SessionMany(t *testing.T) {
+	tester.Many(t, newStore)
+}
+
+func TestFilesystem_SessionRegenerate(t *testing.T) {
+	tester.Regenerate(t, newStore)
+}
+
+func TestFilesystem_SessionMaxLifetime(t *testing.T) {
+	tester.MaxLifetime(t, newStore)
+}
+
+func TestFilesystem_SessionAutoSave(t *testing.T) {
+	tester.AutoSave(t, newStore)
+}
+
+func TestFilesystem_SessionContextKey(t *testing.T) {
+	tester.ContextKey(t, newStore)
+}
+
+func TestFilesystem_SessionInvalidCookie(t *testing.T) {
+	tester.InvalidCookie(t, newStore)
+}
+
+func TestFilesystem_SessionGetAs(t *testing.T) {
+	tester.GetAs(t, newStore)
+	tester.GetAs(t, func(t *testing.T) sessions.Store {
+		store := newStore(t).(*Store)
+		store.SetSerializer(sessions.JSONSerializer{})
+		return store
+	})
+}
+
+func TestFilesystem_SessionLazy(t *testing.T) {
+	tester.Lazy(t, newStore)
+}
+
+func TestFilesystem_SessionKeyRing(t *testing.T) {
+	tester.KeyRing(t, func(t *testing.T, ring *sessions.KeyRing) sessions.Store {
+		store := newStore(t).(*Store)
+		store.Codecs = ring.Codecs()
+		return store
+	})
+}
+
+func TestFilesystem_Expiry(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStoreWithCleanup(dir, 10*time.Millisecond, []byte("secret"))
+	assert.Nil(t, err)
+	defer store.Close()
+	store.DefaultMaxAge = 1
+	store.Opts.MaxAge = 0
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	assert.Nil(t, err)
+	session.Values["key"] = "val"
+	assert.Nil(t, store.Save(req, httptest.NewRecorder(), session))
+
+	// a temporary file left over by a crash long ago
+	stale := filepath.Join(dir, filePrefix+"crashed"+tempSuffix)
+	assert.Nil(t, os.WriteFile(stale, nil, 0o600))
+	old := time.Now().Add(-2 * tempGrace)
+	assert.Nil(t, os.Chtimes(stale, old, old))
+
+	ok, err := store.load(session)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	time.Sleep(1100 * time.Millisecond)
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 0, len(entries))
+}
+
+func TestFilesystem_MaxLength(t *testing.T) {
+	store, err := NewStoreWithCleanup(t.TempDir(), 0, []byte("secret"))
+	assert.Nil(t, err)
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	assert.Nil(t, err)
+	session.Values["big"] = make([]byte, 8192)
+	assert.NotNil(t, store.Save(req, httptest.NewRecorder(), session))
+	store.SetMaxLength(0)
+	assert.Nil(t, store.Save(req, httptest.NewRecorder(), session))
+}
+
+func TestFilesystem_TempDir(t *testing.T) {
+	store1, err := NewStoreWithCleanup("", 0, []byte("secret"))
+	assert.Nil(t, err)
+	store2, err := NewStoreWithCleanup("", 0, []byte("secret"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, os.TempDir(), store1.path)
+	assert.NotEqual(t, store1.path, store2.path)
+
+	assert.Nil(t, store1.Close())
+	_, err = os.Stat(store1.path)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(store2.path)
+	assert.Nil(t, err)
+	assert.Nil(t, store2.Close())
+}
@@ -0,0 +1,53 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sessions
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GetAs returns the session value associated to the given key as a T.
+// The bool reports whether the session holds a value for the key.
+//
+// Values which are not already a T are converted through JSON, so that
+// values decoded by JSONSerializer, such as float64 numbers or
+// map[string]interface{} structs, read back as the type they were set with.
+// An error is returned if the value can't be converted.
+//
+// GetAs requires Go 1.18, the rest of the package builds with Go 1.16.
+func GetAs[T any](s Session, key interface{}) (T, bool, error) {
+	var t T
+	v := s.Get(key)
+	if v == nil {
+		return t, false, nil
+	}
+	if t, ok := v.(T); ok {
+		return t, true, nil
+	}
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(b, &t)
+	}
+	if err != nil {
+		return t, true, fmt.Errorf("sessions: can't convert %T value of key %v to %T: %w", v, key, t, err)
+	}
+	return t, true, nil
+}
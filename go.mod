@@ -3,10 +3,14 @@ module github.com/hertz-contrib/sessions
 go 1.16
 
 require (
+	github.com/alicebob/miniredis/v2 v2.31.0
 	github.com/cloudwego/hertz v0.7.2
 	github.com/gomodule/redigo v1.8.9
 	github.com/gorilla/context v1.1.2
 	github.com/gorilla/securecookie v1.1.2
 	github.com/gorilla/sessions v1.2.2
+	github.com/mattn/go-sqlite3 v1.14.19
 	github.com/redis/go-redis/v9 v9.3.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	go.etcd.io/bbolt v1.3.9
 )
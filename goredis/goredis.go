@@ -0,0 +1,368 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package goredis
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	hs "github.com/hertz-contrib/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// Amount of time for cookies/redis keys to expire.
+var sessionExpire = 86400 * 30
+
+// touchScript extends the TTL of KEYS[1] to ARGV[1] milliseconds once at
+// least ARGV[2] milliseconds have passed since it was last set.
+var touchScript = redis.NewScript(`
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 and tonumber(ARGV[1]) - ttl >= tonumber(ARGV[2]) then
+		return redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	end
+	return 0
+`)
+
+// Store stores sessions in redis through a go-redis redis.UniversalClient,
+// so the same store serves standalone, Sentinel failover and cluster clients.
+type Store struct {
+	Rdb           redis.UniversalClient
+	Codecs        []securecookie.Codec
+	Opts          *sessions.Options // default configuration
+	DefaultMaxAge int               // default Redis TTL for a MaxAge == 0 session
+	maxLength     int
+	keyPrefix     string
+	serializer    hs.Serializer
+	timeout       time.Duration
+	maxLifetime   int
+
+	rolling         bool
+	rollingInterval time.Duration
+	rollingCookie   bool
+}
+
+func (s *Store) Options(options hs.Options) {
+	s.Opts = options.ToGorillaOptions()
+	s.maxLifetime = options.MaxLifetime
+}
+
+// NewStore returns a new goredis.Store using the given client.
+func NewStore(rdb redis.UniversalClient, kvs ...[]byte) (*Store, error) {
+	rs := &Store{
+		Rdb:    rdb,
+		Codecs: securecookie.CodecsFromPairs(kvs...),
+		Opts: &sessions.Options{
+			Path:   "/",
+			MaxAge: sessionExpire,
+		},
+		DefaultMaxAge: 60 * 20, // 20 minutes seems like a reasonable default
+		maxLength:     4096,
+		keyPrefix:     "session_",
+		serializer:    hs.GobSerializer{},
+	}
+	_, err := rs.ping()
+	return rs, err
+}
+
+// NewStoreWithOption returns a new goredis.Store by setting *redis.UniversalOptions.
+//
+// See redis.NewUniversalClient for how the kind of client is chosen.
+func NewStoreWithOption(opt *redis.UniversalOptions, kvs ...[]byte) (*Store, error) {
+	return NewStore(redis.NewUniversalClient(opt), kvs...)
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	var (
+		err error
+		ok  bool
+	)
+	session := sessions.NewSession(s, name)
+	// make a copy
+	options := *s.Opts
+	session.Options = &options
+	session.IsNew = true
+	if c, errCookie := r.Cookie(name); errCookie == nil {
+		err = hs.DecodeCookie(r.Context(), name, c.Value, &session.ID, s.Codecs...)
+		if err == nil {
+			ok, err = s.load(r.Context(), session)
+			session.IsNew = !(err == nil && ok) // not new if no error and data available
+		}
+	}
+	if err == nil && hs.LifetimeExceeded(session, s.maxLifetime) {
+		// The session outlived its absolute lifetime, start over.
+		if err = s.delete(r.Context(), session); err != nil {
+			return session, err
+		}
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+	}
+	if s.maxLifetime > 0 {
+		hs.StampCreated(session)
+	}
+	return session, err
+}
+
+// Save adds a single session to the response.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	// Marked for deletion.
+	if session.Options.MaxAge <= 0 {
+		if err := s.delete(r.Context(), session); err != nil {
+			return err
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+	} else {
+		// Build an alphanumeric key for the redis store.
+		if session.ID == "" {
+			session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+		}
+		if err := s.save(r.Context(), session); err != nil {
+			return err
+		}
+		encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+		if err != nil {
+			return err
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	}
+	return nil
+}
+
+// Touch refreshes the TTL of a session that was read but not modified
+// when sliding expiration is enabled. See SetRolling.
+func (s *Store) Touch(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if !s.rolling || session.IsNew || session.ID == "" || session.Options.MaxAge < 0 {
+		return nil
+	}
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	if !hs.TouchDue(session, time.Duration(age)*time.Second, s.rollingInterval) {
+		return nil
+	}
+	touched, err := s.touch(r.Context(), session, time.Duration(age)*time.Second)
+	if err != nil || !touched {
+		return err
+	}
+	hs.StampTTL(session, time.Duration(age)*time.Second)
+	if !s.rollingCookie {
+		return nil
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Regenerate removes the session from redis and clears its ID,
+// so that the next Save stores the values under a fresh ID.
+func (s *Store) Regenerate(r *http.Request, session *sessions.Session) error {
+	if session.ID != "" {
+		if err := s.delete(r.Context(), session); err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	return nil
+}
+
+// Close closes the underlying redis client.
+func (s *Store) Close() error {
+	return s.Rdb.Close()
+}
+
+// SetMaxLength sets Store.maxLength if the `l` argument is greater or equal 0
+// maxLength restricts the maximum length of new sessions to l.
+// If l is 0 there is no limit to the size of a session, use with caution.
+// The default for a new Store is 4096. Redis allows for max.
+// value sizes of up to 512MB (http://redis.io/topics/data-types)
+// Default: 4096,
+func (s *Store) SetMaxLength(l int) {
+	if l >= 0 {
+		s.maxLength = l
+	}
+}
+
+// SetKeyPrefix set the prefix
+func (s *Store) SetKeyPrefix(p string) {
+	s.keyPrefix = p
+}
+
+// SetSerializer sets the serializer
+func (s *Store) SetSerializer(ss hs.Serializer) {
+	s.serializer = ss
+}
+
+// SetMaxLifetime caps the lifetime, in seconds, of the sessions of the store
+// counted from their creation regardless of activity. Older sessions are
+// deleted and treated as new. Set it to 0 for no restriction.
+func (s *Store) SetMaxLifetime(v int) {
+	s.maxLifetime = v
+}
+
+// SetTimeout sets the timeout of every redis operation issued by the store.
+// Operations are also canceled together with the request they serve.
+// Default: 0, no timeout.
+func (s *Store) SetTimeout(d time.Duration) {
+	s.timeout = d
+}
+
+// SetMaxAge restricts the maximum age, in seconds, of the session record
+// both in database and a browser.
+//
+// See redis.RediStore.SetMaxAge.
+func (s *Store) SetMaxAge(v int) {
+	s.Opts.MaxAge = v
+	hs.SetCodecsMaxAge(s.Codecs, v)
+}
+
+// SetRolling enables sliding expiration. A session that was read but not
+// modified then has its TTL refreshed when the handler returns or saves it,
+// at most once per minInterval, so that active users are not logged out
+// after the session age.
+// The TTL is read along with the session, so that touching it within
+// minInterval costs no round trip.
+// With refreshCookie the cookie is sent again so its Max-Age slides too.
+func (s *Store) SetRolling(minInterval time.Duration, refreshCookie bool) {
+	s.rolling = true
+	s.rollingInterval = minInterval
+	s.rollingCookie = refreshCookie
+}
+
+// withTimeout bounds ctx by the operation timeout of the store, if any.
+func (s *Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(ctx, s.timeout)
+	}
+	return ctx, func() {}
+}
+
+// load reads the session from redis.
+// returns true if there is a session data in DB
+func (s *Store) load(ctx context.Context, session *sessions.Session) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if !s.rolling {
+		b, err := s.Rdb.Get(ctx, s.keyPrefix+session.ID).Bytes()
+		if err == redis.Nil {
+			return false, nil // no data was associated with this key
+		}
+		if err != nil {
+			return false, hs.Unavailable(err)
+		}
+		return true, s.serializer.Deserialize(b, session)
+	}
+	// read the TTL along, to touch the session only once it is due
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := s.Rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		get = p.Get(ctx, s.keyPrefix+session.ID)
+		pttl = p.PTTL(ctx, s.keyPrefix+session.ID)
+		return nil
+	})
+	if err == redis.Nil {
+		return false, nil // no data was associated with this key
+	}
+	if err != nil {
+		return false, hs.Unavailable(err)
+	}
+	b, _ := get.Bytes()
+	if err = s.serializer.Deserialize(b, session); err != nil {
+		return true, err
+	}
+	hs.StampTTL(session, pttl.Val())
+	return true, nil
+}
+
+// touch extends the TTL of the session to age, unless it was already
+// refreshed within the rolling interval. Returns true if the TTL was extended.
+func (s *Store) touch(ctx context.Context, session *sessions.Session, age time.Duration) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	n, err := touchScript.Run(ctx, s.Rdb, []string{s.keyPrefix + session.ID}, age.Milliseconds(), s.rollingInterval.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// save stores the session in redis.
+func (s *Store) save(ctx context.Context, session *sessions.Session) error {
+	hs.UnstampTTL(session)
+	b, err := s.serializer.Serialize(session)
+	if err != nil {
+		return err
+	}
+	if s.maxLength != 0 && len(b) > s.maxLength {
+		return errors.New("SessionStore: the value to store is too big")
+	}
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.Rdb.SetEx(ctx, s.keyPrefix+session.ID, b, time.Duration(age)*time.Second).Err()
+}
+
+// delete removes keys from redis if MaxAge<0
+func (s *Store) delete(ctx context.Context, session *sessions.Session) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.Rdb.Del(ctx, s.keyPrefix+session.ID).Err()
+}
+
+// ping does an internal ping against a server to check if it is alive.
+func (s *Store) ping() (bool, error) {
+	result, err := s.Rdb.Ping(context.Background()).Result()
+	if err != nil {
+		return false, err
+	}
+	return result == "PONG", nil
+}
+
+// LoadSessionBySessionId Get session using session_id even without a context
+func LoadSessionBySessionId(s *Store, sessionId string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, "")
+	session.ID = sessionId
+	exist, err := s.load(context.Background(), session)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// SaveSessionWithoutContext Save session even without a context
+func SaveSessionWithoutContext(s *Store, sessionId string, session *sessions.Session) error {
+	session.ID = sessionId
+	return s.save(context.Background(), session)
+}
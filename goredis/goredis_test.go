@@ -0,0 +1,230 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package goredis
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+	hs "github.com/hertz-contrib/sessions"
+	"github.com/hertz-contrib/sessions/tester"
+	"github.com/redis/go-redis/v9"
+)
+
+var newStore = func(t *testing.T) hs.Store {
+	mr := miniredis.RunT(t)
+	store, err := NewStoreWithOption(&redis.UniversalOptions{Addrs: []string{mr.Addr()}}, []byte("secret"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return store
+}
+
+func TestGoRedis_SessionGetSet(t *testing.T) {
+	tester.GetSet(t, newStore)
+}
+
+func TestGoRedis_SessionDeleteKey(t *testing.T) {
+	tester.DeleteKey(t, newStore)
+}
+
+func TestGoRedis_SessionFlashes(t *testing.T) {
+	tester.Flashes(t, newStore)
+}
+
+func TestGoRedis_SessionClear(t *testing.T) {
+	tester.Clear(t, newStore)
+}
+
+func TestGoRedis_SessionOptions(t *testing.T) {
+	tester.Options(t, newStore)
+}
+
+func TestGoRedis_SessionMany(t *testing.T) {
+	tester.Many(t, newStore)
+}
+
+func TestGoRedis_SessionRegenerate(t *testing.T) {
+	tester.Regenerate(t, newStore)
+}
+
+func TestGoRedis_SessionMaxLifetime(t *testing.T) {
+	tester.MaxLifetime(t, newStore)
+}
+
+func TestGoRedis_SessionAutoSave(t *testing.T) {
+	tester.AutoSave(t, newStore)
+}
+
+func TestGoRedis_SessionContextKey(t *testing.T) {
+	tester.ContextKey(t, newStore)
+}
+
+func TestGoRedis_SessionInvalidCookie(t *testing.T) {
+	tester.InvalidCookie(t, newStore)
+}
+
+func TestGoRedis_SessionGetAs(t *testing.T) {
+	tester.GetAs(t, newStore)
+	tester.GetAs(t, func(t *testing.T) hs.Store {
+		store := newStore(t).(*Store)
+		store.SetSerializer(hs.JSONSerializer{})
+		return store
+	})
+}
+
+func TestGoRedis_SessionLazy(t *testing.T) {
+	tester.Lazy(t, newStore)
+}
+
+func TestGoRedis_SessionKeyRing(t *testing.T) {
+	tester.KeyRing(t, func(t *testing.T, ring *hs.KeyRing) hs.Store {
+		store := newStore(t).(*Store)
+		store.Codecs = ring.Codecs()
+		return store
+	})
+}
+
+func TestStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), []byte("secret"))
+	assert.Nil(t, err)
+	defer store.Close()
+	store.SetKeyPrefix("prefix_")
+	store.SetSerializer(hs.JSONSerializer{})
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	assert.Nil(t, err)
+	session.Values["big"] = string(make([]byte, 4096))
+	assert.NotNil(t, store.Save(req, httptest.NewRecorder(), session))
+
+	store.SetMaxLength(0)
+	assert.Nil(t, store.Save(req, httptest.NewRecorder(), session))
+	assert.True(t, mr.Exists("prefix_"+session.ID))
+
+	s, err := LoadSessionBySessionId(store, session.ID)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, session.Values["big"], s.Values["big"])
+
+	s, err = LoadSessionBySessionId(store, "missing")
+	assert.Nil(t, err)
+	assert.Nil(t, s)
+}
+
+func TestStore_Rolling(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), []byte("secret"))
+	assert.Nil(t, err)
+	defer store.Close()
+	store.SetRolling(time.Minute, true)
+	age := time.Duration(store.Opts.MaxAge) * time.Second
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	assert.Nil(t, err)
+	session.Values["key"] = "val"
+	w := httptest.NewRecorder()
+	assert.Nil(t, store.Save(req, w, session))
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", w.Header().Get("Set-Cookie"))
+	session, err = store.New(req, "session-key")
+	assert.Nil(t, err)
+	key := "session_" + session.ID
+
+	mr.FastForward(30 * time.Second)
+	w = httptest.NewRecorder()
+	commands := mr.CommandCount()
+	assert.Nil(t, store.Touch(req, w, session))
+	// the TTL read along with the session tells the touch isn't due yet
+	assert.DeepEqual(t, commands, mr.CommandCount())
+	assert.DeepEqual(t, age-30*time.Second, mr.TTL(key))
+	assert.DeepEqual(t, "", w.Header().Get("Set-Cookie"))
+
+	mr.FastForward(time.Minute)
+	session, err = store.New(req, "session-key")
+	assert.Nil(t, err)
+	w = httptest.NewRecorder()
+	assert.Nil(t, store.Touch(req, w, session))
+	assert.DeepEqual(t, age, mr.TTL(key))
+	assert.NotEqual(t, "", w.Header().Get("Set-Cookie"))
+}
+
+func TestStore_AutoSaveError(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), []byte("secret"))
+	assert.Nil(t, err)
+	defer store.Close()
+	store.SetMaxLength(1)
+
+	var handled error
+	r := route.NewEngine(config.NewOptions(nil))
+	r.Use(hs.New("mysession", store, hs.WithAutoSave(true), hs.WithErrorHandler(
+		func(ctx context.Context, c *app.RequestContext, err error) {
+			handled = err
+		},
+	)))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		hs.Default(c).Set("key", "val")
+	})
+	_ = ut.PerformRequest(r, "GET", "/set", nil)
+	assert.NotNil(t, handled)
+}
+
+func TestStore_Unavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1}), []byte("secret"))
+	assert.Nil(t, err)
+	defer store.Close()
+
+	r := route.NewEngine(config.NewOptions(nil))
+	r.Use(hs.New("mysession", store, hs.WithUnavailableStatus(consts.StatusServiceUnavailable)))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		hs.Default(c).Set("key", "val")
+		assert.Nil(t, hs.Default(c).Save())
+	})
+	r.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+		t.Error("Handler called with an unavailable store")
+	})
+	w := ut.PerformRequest(r, "GET", "/set", nil)
+	cookie := w.Result().Header.Get("Set-Cookie")
+
+	var loadErr error
+	r2 := route.NewEngine(config.NewOptions(nil))
+	r2.Use(hs.New("mysession", store))
+	r2.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+		loadErr = hs.Default(c).Err()
+	})
+
+	mr.Close()
+	w = ut.PerformRequest(r, "GET", "/get", nil, ut.Header{Key: "Cookie", Value: cookie})
+	assert.DeepEqual(t, consts.StatusServiceUnavailable, w.Code)
+	_ = ut.PerformRequest(r2, "GET", "/get", nil, ut.Header{Key: "Cookie", Value: cookie})
+	assert.True(t, errors.Is(loadErr, hs.ErrStoreUnavailable))
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sessions
+
+import (
+	"context"
+	"crypto/aes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/gorilla/securecookie"
+)
+
+// Key is a key pair of a KeyRing. In a key file, the keys are base64 encoded:
+//
+//	[{"id": "2024", "hash_key": "...", "block_key": "..."}]
+type Key struct {
+	// ID names the key, e.g. to report which key decoded a cookie.
+	ID string `json:"id"`
+	// HashKey authenticates the cookies, 32 or 64 bytes are recommended.
+	HashKey []byte `json:"hash_key"`
+	// BlockKey encrypts the cookies if set, 16, 24 or 32 bytes long to
+	// select AES-128, AES-192 or AES-256.
+	BlockKey []byte `json:"block_key,omitempty"`
+}
+
+type keySet struct {
+	keys   []Key
+	codecs []*securecookie.SecureCookie
+}
+
+// KeyRing is a securecookie.Codec holding several key pairs, which can be
+// replaced at runtime without restarting. The first key encodes, all keys
+// decode: to rotate keys, put the new one first, cookies are then encoded
+// with it on their next Save, and drop the old one once they have expired.
+//
+// A KeyRing can be shared by all stores, in place of their codecs:
+//
+//	store.Codecs = ring.Codecs()
+type KeyRing struct {
+	set    atomic.Value // *keySet
+	mu     sync.Mutex
+	maxAge *int
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewKeyRing returns a KeyRing holding the given keys, newest first.
+func NewKeyRing(keys ...Key) (*KeyRing, error) {
+	r := &KeyRing{done: make(chan struct{})}
+	if err := r.Set(keys...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadKeyRing returns a KeyRing holding the keys of a JSON key file.
+func LoadKeyRing(path string) (*KeyRing, error) {
+	keys, err := readKeys(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyRing(keys...)
+}
+
+func readKeys(path string) ([]Key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []Key
+	if err = json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("sessions: key file %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// Set replaces the keys of the ring, newest first. The swap is atomic:
+// concurrent requests use either the old or the new keys.
+func (r *KeyRing) Set(keys ...Key) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.swap(keys)
+}
+
+func (r *KeyRing) swap(keys []Key) error {
+	if len(keys) == 0 {
+		return errors.New("sessions: no key in key ring")
+	}
+	set := &keySet{
+		keys:   append([]Key(nil), keys...),
+		codecs: make([]*securecookie.SecureCookie, 0, len(keys)),
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k.ID == "" || seen[k.ID] {
+			return fmt.Errorf("sessions: missing or duplicate key ID %q", k.ID)
+		}
+		seen[k.ID] = true
+		if len(k.HashKey) == 0 {
+			return fmt.Errorf("sessions: key %q: hash key not set", k.ID)
+		}
+		if len(k.BlockKey) > 0 {
+			if _, err := aes.NewCipher(k.BlockKey); err != nil {
+				return fmt.Errorf("sessions: key %q: %w", k.ID, err)
+			}
+		}
+		c := securecookie.New(k.HashKey, k.BlockKey)
+		if r.maxAge != nil {
+			c.MaxAge(*r.maxAge)
+		}
+		set.codecs = append(set.codecs, c)
+	}
+	r.set.Store(set)
+	return nil
+}
+
+// MaxAge restricts the maximum age, in seconds, of the cookies decoded by
+// the ring. Stores call it from SetMaxAge, so with a ring shared by several
+// stores the last age set applies to the cookies of all of them.
+func (r *KeyRing) MaxAge(age int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxAge = &age
+	// rebuild the codecs rather than changing the ones in use
+	_ = r.swap(r.load().keys)
+}
+
+func (r *KeyRing) load() *keySet {
+	return r.set.Load().(*keySet)
+}
+
+// IDs returns the IDs of the keys of the ring, newest first.
+func (r *KeyRing) IDs() []string {
+	set := r.load()
+	ids := make([]string, len(set.keys))
+	for i, k := range set.keys {
+		ids[i] = k.ID
+	}
+	return ids
+}
+
+// Codecs returns the ring as the codecs of a store.
+func (r *KeyRing) Codecs() []securecookie.Codec {
+	return []securecookie.Codec{r}
+}
+
+// Encode encodes a cookie value with the newest key.
+func (r *KeyRing) Encode(name string, value interface{}) (string, error) {
+	return r.load().codecs[0].Encode(name, value)
+}
+
+// Decode decodes a cookie value with the first key that can.
+func (r *KeyRing) Decode(name, value string, dst interface{}) error {
+	_, err := r.DecodeKey(name, value, dst)
+	return err
+}
+
+// DecodeKey decodes a cookie value like Decode, and returns the ID of the
+// key which decoded it. The ID is not the newest one for cookies encoded
+// before a rotation.
+func (r *KeyRing) DecodeKey(name, value string, dst interface{}) (string, error) {
+	set := r.load()
+	var errs securecookie.MultiError
+	for i, c := range set.codecs {
+		err := c.Decode(name, value, dst)
+		if err == nil {
+			return set.keys[i].ID, nil
+		}
+		errs = append(errs, err)
+	}
+	return "", errs
+}
+
+// Watch reloads the keys of the ring from a JSON key file whenever the file
+// changes, checking every interval until Close is called. A file which can't
+// be loaded is logged and the keys in use are kept.
+func (r *KeyRing) Watch(path string, interval time.Duration) {
+	var last os.FileInfo
+	if fi, err := os.Stat(path); err == nil {
+		last = fi
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fi, err := os.Stat(path)
+				if err != nil {
+					hlog.Warnf("sessions: key file %s: %v", path, err)
+					continue
+				}
+				if last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+					continue
+				}
+				last = fi
+				keys, err := readKeys(path)
+				if err == nil {
+					err = r.Set(keys...)
+				}
+				if err != nil {
+					hlog.Warnf("sessions: reload key file %s: %v", path, err)
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops watching the key file.
+func (r *KeyRing) Close() error {
+	r.once.Do(func() { close(r.done) })
+	return nil
+}
+
+// SetCodecsMaxAge restricts the maximum age, in seconds, of the cookies
+// decoded by codecs, for the SetMaxAge method of stores. A KeyRing is
+// shared: see KeyRing.MaxAge.
+func SetCodecsMaxAge(codecs []securecookie.Codec, age int) {
+	for i := range codecs {
+		if c, ok := codecs[i].(*securecookie.SecureCookie); ok {
+			c.MaxAge(age)
+		} else if r, ok := codecs[i].(*KeyRing); ok {
+			r.MaxAge(age)
+		} else {
+			hlog.Warnf("Can't change MaxAge on codec %v\n", codecs[i])
+		}
+	}
+}
+
+// keyIDsKey is the context key of the IDs of the keys which decoded the
+// cookies of a request, by cookie name.
+type keyIDsKey struct{}
+
+// DecodeCookie decodes a cookie value like securecookie.DecodeMulti. Stores
+// use it with the context of the request, so that Session.KeyID reports the
+// key of a KeyRing which decoded the cookie.
+func DecodeCookie(ctx context.Context, name, value string, dst interface{}, codecs ...securecookie.Codec) error {
+	if len(codecs) == 0 {
+		return securecookie.DecodeMulti(name, value, dst)
+	}
+	var errs securecookie.MultiError
+	for _, codec := range codecs {
+		var id string
+		var err error
+		if r, ok := codec.(*KeyRing); ok {
+			id, err = r.DecodeKey(name, value, dst)
+		} else {
+			err = codec.Decode(name, value, dst)
+		}
+		if err == nil {
+			if ids, ok := ctx.Value(keyIDsKey{}).(map[string]string); ok && id != "" {
+				ids[name] = id
+			}
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
@@ -0,0 +1,285 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memstore
+
+import (
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	hs "github.com/hertz-contrib/sessions"
+)
+
+// Amount of time for cookies to expire.
+var sessionExpire = 86400 * 30
+
+// Store stores sessions in the memory of the current process.
+// Only the securecookie-encoded session ID is sent to the client.
+type Store struct {
+	Codecs        []securecookie.Codec
+	Opts          *sessions.Options // default configuration
+	DefaultMaxAge int               // default TTL for a MaxAge == 0 session
+	maxLifetime   int
+
+	rolling         bool
+	rollingInterval time.Duration
+	rollingCookie   bool
+
+	mu      sync.RWMutex
+	records map[string]record
+	done    chan struct{}
+	once    sync.Once
+}
+
+// record is a snapshot of the session values kept by the store.
+type record struct {
+	values  map[interface{}]interface{}
+	expires time.Time
+}
+
+func (s *Store) Options(options hs.Options) {
+	s.Opts = options.ToGorillaOptions()
+	s.maxLifetime = options.MaxLifetime
+}
+
+// NewStore returns a new memstore.Store which removes expired sessions every minute.
+func NewStore(kvs ...[]byte) *Store {
+	return NewStoreWithCleanup(time.Minute, kvs...)
+}
+
+// NewStoreWithCleanup returns a new memstore.Store whose janitor removes
+// expired sessions every interval. If interval <= 0 no janitor is started
+// and expired sessions are only dropped when they are read.
+func NewStoreWithCleanup(interval time.Duration, kvs ...[]byte) *Store {
+	s := &Store{
+		Codecs: securecookie.CodecsFromPairs(kvs...),
+		Opts: &sessions.Options{
+			Path:   "/",
+			MaxAge: sessionExpire,
+		},
+		DefaultMaxAge: 60 * 20, // 20 minutes seems like a reasonable default
+		records:       make(map[string]record),
+		done:          make(chan struct{}),
+	}
+	if interval > 0 {
+		go s.janitor(interval)
+	}
+	return s
+}
+
+// Close stops the janitor of the store.
+func (s *Store) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// SetMaxAge restricts the maximum age, in seconds, of the session record
+// both in memory and a browser.
+//
+// See RediStore.SetMaxAge.
+func (s *Store) SetMaxAge(v int) {
+	s.Opts.MaxAge = v
+	hs.SetCodecsMaxAge(s.Codecs, v)
+}
+
+// SetMaxLifetime caps the lifetime, in seconds, of the sessions of the store
+// counted from their creation regardless of activity. Older sessions are
+// deleted and treated as new. Set it to 0 for no restriction.
+func (s *Store) SetMaxLifetime(v int) {
+	s.maxLifetime = v
+}
+
+// SetRolling enables sliding expiration. A session that was read but not
+// modified then has its TTL refreshed when the handler returns or saves it,
+// at most once per minInterval, so that active users are not logged out
+// after the session age.
+// With refreshCookie the cookie is sent again so its Max-Age slides too.
+func (s *Store) SetRolling(minInterval time.Duration, refreshCookie bool) {
+	s.rolling = true
+	s.rollingInterval = minInterval
+	s.rollingCookie = refreshCookie
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	var err error
+	session := sessions.NewSession(s, name)
+	// make a copy
+	options := *s.Opts
+	session.Options = &options
+	session.IsNew = true
+	if c, errCookie := r.Cookie(name); errCookie == nil {
+		err = hs.DecodeCookie(r.Context(), name, c.Value, &session.ID, s.Codecs...)
+		if err == nil {
+			session.IsNew = !s.load(session)
+		}
+	}
+	if err == nil && hs.LifetimeExceeded(session, s.maxLifetime) {
+		// The session outlived its absolute lifetime, start over.
+		s.delete(session)
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+	}
+	if s.maxLifetime > 0 {
+		hs.StampCreated(session)
+	}
+	return session, err
+}
+
+// Save adds a single session to the response.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	// Marked for deletion.
+	if session.Options.MaxAge < 0 {
+		s.delete(session)
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	s.save(session)
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Touch refreshes the TTL of a session that was read but not modified
+// when sliding expiration is enabled. See SetRolling.
+func (s *Store) Touch(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if !s.rolling || session.IsNew || session.ID == "" || session.Options.MaxAge < 0 {
+		return nil
+	}
+	if !s.touch(session) || !s.rollingCookie {
+		return nil
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Regenerate removes the session from memory and clears its ID,
+// so that the next Save stores the values under a fresh ID.
+func (s *Store) Regenerate(r *http.Request, session *sessions.Session) error {
+	s.delete(session)
+	session.ID = ""
+	return nil
+}
+
+// age returns the TTL of the session.
+func (s *Store) age(session *sessions.Session) time.Duration {
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	return time.Duration(age) * time.Second
+}
+
+// save stores a copy of the session values in memory.
+func (s *Store) save(session *sessions.Session) {
+	values := make(map[interface{}]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		values[k] = v
+	}
+	s.mu.Lock()
+	s.records[session.ID] = record{
+		values:  values,
+		expires: time.Now().Add(s.age(session)),
+	}
+	s.mu.Unlock()
+}
+
+// load copies the stored values into the session.
+// returns true if there is a live session record in memory
+func (s *Store) load(session *sessions.Session) bool {
+	s.mu.RLock()
+	rec, ok := s.records[session.ID]
+	s.mu.RUnlock()
+	if !ok || time.Now().After(rec.expires) {
+		return false
+	}
+	for k, v := range rec.values {
+		session.Values[k] = v
+	}
+	return true
+}
+
+// touch extends the TTL of the session, unless it was already refreshed
+// within the rolling interval. Returns true if the TTL was extended.
+func (s *Store) touch(session *sessions.Session) bool {
+	age := s.age(session)
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[session.ID]
+	if !ok || now.After(rec.expires) || age-rec.expires.Sub(now) < s.rollingInterval {
+		return false
+	}
+	rec.expires = now.Add(age)
+	s.records[session.ID] = rec
+	return true
+}
+
+// delete removes the session record from memory.
+func (s *Store) delete(session *sessions.Session) {
+	s.mu.Lock()
+	delete(s.records, session.ID)
+	s.mu.Unlock()
+}
+
+// janitor periodically removes expired session records until the store is closed.
+func (s *Store) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.cleanup()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// cleanup removes all expired session records.
+func (s *Store) cleanup() {
+	now := time.Now()
+	s.mu.Lock()
+	for id, rec := range s.records {
+		if now.After(rec.expires) {
+			delete(s.records, id)
+		}
+	}
+	s.mu.Unlock()
+}
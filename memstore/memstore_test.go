@@ -0,0 +1,150 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package memstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/hertz-contrib/sessions"
+	"github.com/hertz-contrib/sessions/tester"
+)
+
+var newStore = func(_ *testing.T) sessions.Store {
+	return NewStore([]byte("secret"))
+}
+
+func TestMemstore_SessionGetSet(t *testing.T) {
+	tester.GetSet(t, newStore)
+}
+
+func TestMemstore_SessionDeleteKey(t *testing.T) {
+	tester.DeleteKey(t, newStore)
+}
+
+func TestMemstore_SessionFlashes(t *testing.T) {
+	tester.Flashes(t, newStore)
+}
+
+func TestMemstore_SessionClear(t *testing.T) {
+	tester.Clear(t, newStore)
+}
+
+func TestMemstore_SessionOptions(t *testing.T) {
+	tester.Options(t, newStore)
+}
+
+func TestMemstore_SessionMany(t *testing.T) {
+	tester.Many(t, newStore)
+}
+
+func TestMemstore_SessionRegenerate(t *testing.T) {
+	tester.Regenerate(t, newStore)
+}
+
+func TestMemstore_SessionMaxLifetime(t *testing.T) {
+	tester.MaxLifetime(t, newStore)
+}
+
+func TestMemstore_SessionAutoSave(t *testing.T) {
+	tester.AutoSave(t, newStore)
+}
+
+func TestMemstore_SessionContextKey(t *testing.T) {
+	tester.ContextKey(t, newStore)
+}
+
+func TestMemstore_SessionInvalidCookie(t *testing.T) {
+	tester.InvalidCookie(t, newStore)
+}
+
+func TestMemstore_SessionGetAs(t *testing.T) {
+	tester.GetAs(t, newStore)
+}
+
+func TestMemstore_SessionLazy(t *testing.T) {
+	tester.Lazy(t, newStore)
+}
+
+func TestMemstore_SessionKeyRing(t *testing.T) {
+	tester.KeyRing(t, func(_ *testing.T, ring *sessions.KeyRing) sessions.Store {
+		store := NewStore()
+		store.Codecs = ring.Codecs()
+		return store
+	})
+}
+
+func TestMemstore_Expiry(t *testing.T) {
+	store := NewStoreWithCleanup(10*time.Millisecond, []byte("secret"))
+	defer store.Close()
+	store.DefaultMaxAge = 1
+	store.Opts.MaxAge = 0
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	assert.Nil(t, err)
+	session.Values["key"] = "val"
+	assert.Nil(t, store.Save(req, httptest.NewRecorder(), session))
+
+	assert.True(t, store.load(session))
+	time.Sleep(1100 * time.Millisecond)
+
+	store.mu.RLock()
+	n := len(store.records)
+	store.mu.RUnlock()
+	assert.DeepEqual(t, 0, n)
+}
+
+func TestMemstore_Rolling(t *testing.T) {
+	store := NewStoreWithCleanup(0, []byte("secret"))
+	store.SetRolling(time.Hour, true)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	assert.Nil(t, err)
+	session.Values["key"] = "val"
+	w := httptest.NewRecorder()
+	assert.Nil(t, store.Save(req, w, session))
+
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Add("Cookie", w.Header().Get("Set-Cookie"))
+	session, err = store.New(req, "session-key")
+	assert.Nil(t, err)
+	assert.False(t, session.IsNew)
+
+	// Touched within the rolling interval.
+	w = httptest.NewRecorder()
+	assert.Nil(t, store.Touch(req, w, session))
+	assert.DeepEqual(t, "", w.Header().Get("Set-Cookie"))
+
+	// Pretend the record was last refreshed two hours ago.
+	store.mu.Lock()
+	rec := store.records[session.ID]
+	rec.expires = rec.expires.Add(-2 * time.Hour)
+	store.records[session.ID] = rec
+	store.mu.Unlock()
+
+	w = httptest.NewRecorder()
+	assert.Nil(t, store.Touch(req, w, session))
+	assert.NotEqual(t, "", w.Header().Get("Set-Cookie"))
+	store.mu.RLock()
+	assert.True(t, store.records[session.ID].expires.After(rec.expires.Add(time.Hour)))
+	store.mu.RUnlock()
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sessions
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/gorilla/sessions"
+)
+
+// HertzStore is implemented by stores reading their cookies from
+// c.Request.Header and writing them with c.Response.Header.SetCookie.
+// The middleware then uses it instead of converting the request and the
+// response to net/http.
+type HertzStore interface {
+	// GetHertz returns the session for the given name, like Store.New.
+	GetHertz(ctx context.Context, c *app.RequestContext, name string) (*sessions.Session, error)
+	// SaveHertz saves the session and sets its cookie, like Store.Save.
+	SaveHertz(ctx context.Context, c *app.RequestContext, session *sessions.Session) error
+}
+
+// HertzToucher is the Toucher of HertzStore.
+type HertzToucher interface {
+	TouchHertz(ctx context.Context, c *app.RequestContext, session *sessions.Session) error
+}
+
+// HertzRegenerator is the Regenerator of HertzStore.
+type HertzRegenerator interface {
+	RegenerateHertz(ctx context.Context, c *app.RequestContext, session *sessions.Session) error
+}
+
+// Carrier reads the cookies, headers and query of a request and sets the
+// cookies and headers of its response, so that stores and transports share
+// their code between net/http and Hertz.
+type Carrier interface {
+	// Cookie returns the value of the named request cookie, if any.
+	Cookie(name string) (string, bool)
+	// SetCookie sets a response cookie.
+	SetCookie(cookie *http.Cookie)
+	// Header returns the value of the named request header.
+	Header(name string) string
+	// SetHeader sets a response header.
+	SetHeader(name, value string)
+	// Query returns the value of the named query parameter.
+	Query(name string) string
+}
+
+// HTTPCarrier returns the Carrier of a net/http request and response.
+func HTTPCarrier(r *http.Request, w http.ResponseWriter) Carrier {
+	return httpCarrier{r: r, w: w}
+}
+
+// HertzCarrier returns the Carrier of a Hertz request and response.
+func HertzCarrier(c *app.RequestContext) Carrier {
+	return hertzCarrier{c: c}
+}
+
+type httpCarrier struct {
+	r *http.Request
+	w http.ResponseWriter
+}
+
+func (h httpCarrier) Cookie(name string) (string, bool) {
+	c, err := h.r.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	return c.Value, true
+}
+
+func (h httpCarrier) SetCookie(cookie *http.Cookie) {
+	http.SetCookie(h.w, cookie)
+}
+
+func (h httpCarrier) Header(name string) string {
+	return h.r.Header.Get(name)
+}
+
+func (h httpCarrier) SetHeader(name, value string) {
+	h.w.Header().Set(name, value)
+}
+
+func (h httpCarrier) Query(name string) string {
+	return h.r.URL.Query().Get(name)
+}
+
+type hertzCarrier struct {
+	c *app.RequestContext
+}
+
+func (h hertzCarrier) Cookie(name string) (string, bool) {
+	if v := h.c.Request.Header.Cookie(name); v != nil {
+		return string(bytes.TrimSpace(v)), true
+	}
+	// Unlike net/http, Hertz keeps the whitespace around the cookies, e.g.
+	// the newlines of a Cookie header folded over several lines.
+	var value []byte
+	found := false
+	h.c.Request.Header.VisitAllCookie(func(k, v []byte) {
+		if !found && string(bytes.TrimSpace(k)) == name {
+			value, found = bytes.TrimSpace(v), true
+		}
+	})
+	return string(value), found
+}
+
+func (h hertzCarrier) SetCookie(cookie *http.Cookie) {
+	c := protocol.AcquireCookie()
+	defer protocol.ReleaseCookie(c)
+	c.SetKey(cookie.Name)
+	c.SetValue(cookie.Value)
+	// as net/http, leave out the attributes that are not set
+	if cookie.Path != "" {
+		c.SetPath(cookie.Path)
+	}
+	c.SetDomain(cookie.Domain)
+	c.SetExpire(cookie.Expires)
+	if cookie.MaxAge > 0 {
+		c.SetMaxAge(cookie.MaxAge)
+	}
+	c.SetSecure(cookie.Secure)
+	c.SetHTTPOnly(cookie.HttpOnly)
+	switch cookie.SameSite {
+	case http.SameSiteLaxMode:
+		c.SetSameSite(protocol.CookieSameSiteLaxMode)
+	case http.SameSiteStrictMode:
+		c.SetSameSite(protocol.CookieSameSiteStrictMode)
+	case http.SameSiteNoneMode:
+		c.SetSameSite(protocol.CookieSameSiteNoneMode)
+	}
+	h.c.Response.Header.SetCookie(c)
+}
+
+func (h hertzCarrier) Header(name string) string {
+	return string(h.c.Request.Header.Peek(name))
+}
+
+func (h hertzCarrier) SetHeader(name, value string) {
+	h.c.Response.Header.Set(name, value)
+}
+
+func (h hertzCarrier) Query(name string) string {
+	return h.c.Query(name)
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sessions
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+)
+
+// ErrorHandler handles the errors the middleware runs into on its own,
+// such as failures to load sessions or to save them automatically.
+type ErrorHandler func(ctx context.Context, c *app.RequestContext, err error)
+
+type options struct {
+	contextKey        string
+	autoSave          bool
+	errorHandler      ErrorHandler
+	unavailableStatus int
+}
+
+// Option is the only way to set optional configuration of the middleware.
+type Option func(o *options)
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		contextKey:   DefaultKey,
+		errorHandler: defaultErrorHandler,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func defaultErrorHandler(_ context.Context, _ *app.RequestContext, err error) {
+	hlog.Errorf(errorFormat, err)
+}
+
+// WithContextKey sets the key the sessions are stored under in the request
+// context, so that several session middlewares can be used together.
+// Retrieve them with DefaultWithKey and DefaultManyWithKey.
+// Default: DefaultKey.
+func WithContextKey(key string) Option {
+	return func(o *options) {
+		o.contextKey = key
+	}
+}
+
+// WithAutoSave makes the middleware save every session used by the handlers
+// once they return, so they don't have to call Save themselves.
+// Save errors are passed to the error handler.
+func WithAutoSave(enable bool) Option {
+	return func(o *options) {
+		o.autoSave = enable
+	}
+}
+
+// WithErrorHandler sets the handler of the errors the middleware runs into.
+// By default they are logged with hlog.
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(o *options) {
+		o.errorHandler = h
+	}
+}
+
+// WithUnavailableStatus makes the middleware load the sessions before the
+// handlers run, and abort the request with statusCode, typically
+// consts.StatusServiceUnavailable, when the store is unavailable.
+// Sessions with invalid cookies are still handed to the handlers as new ones.
+func WithUnavailableStatus(statusCode int) Option {
+	return func(o *options) {
+		o.unavailableStatus = statusCode
+	}
+}
+
+// unavailable reports whether the request must be aborted because the store
+// of the session is unavailable.
+func (o *options) unavailable(s *session) bool {
+	return o.unavailableStatus != 0 && errors.Is(s.Err(), ErrStoreUnavailable)
+}
@@ -57,6 +57,7 @@ type store struct {
 
 func (s *store) Options(opts sessions.Options) {
 	s.RediStore.Options = opts.ToGorillaOptions()
+	s.RediStore.SetMaxLifetime(opts.MaxLifetime)
 }
 
 func NewStore(size int, network, addr, passwd string, keyPairs ...[]byte) (Store, error) {
@@ -79,6 +80,16 @@ func NewStoreWithDB(size int, network, addr, passwd, DB string, keyPairs ...[]by
 	return &store{s}, nil
 }
 
+// NewStoreWithSentinel - like NewStore but discovers the redis master through
+// the sentinels monitoring it under masterName, and follows failovers.
+func NewStoreWithSentinel(size int, masterName string, sentinelAddrs []string, passwd string, keyPairs ...[]byte) (Store, error) {
+	s, err := NewRediStoreWithSentinel(size, masterName, sentinelAddrs, passwd, keyPairs...)
+	if err != nil {
+		return nil, err
+	}
+	return &store{s}, nil
+}
+
 // NewStoreWithPool instantiates a RediStore with a *redis.Pool passed in.
 //
 // Ref: https://godoc.org/github.com/boj/redistore#NewRediStoreWithPool
@@ -81,6 +81,50 @@ func TestRedis_SessionMany(t *testing.T) {
 	tester.Many(t, newRedisStore)
 }
 
+func TestRedis_SessionRegenerate(t *testing.T) {
+	tester.Regenerate(t, newRedisStore)
+}
+
+func TestRedis_SessionMaxLifetime(t *testing.T) {
+	tester.MaxLifetime(t, newRedisStore)
+}
+
+func TestRedis_SessionAutoSave(t *testing.T) {
+	tester.AutoSave(t, newRedisStore)
+}
+
+func TestRedis_SessionContextKey(t *testing.T) {
+	tester.ContextKey(t, newRedisStore)
+}
+
+func TestRedis_SessionInvalidCookie(t *testing.T) {
+	tester.InvalidCookie(t, newRedisStore)
+}
+
+func TestRedis_SessionGetAs(t *testing.T) {
+	tester.GetAs(t, newRedisStore)
+}
+
+func TestRedis_SessionLazy(t *testing.T) {
+	tester.Lazy(t, newRedisStore)
+}
+
+func TestRedis_SessionNative(t *testing.T) {
+	tester.Native(t, newRedisStore)
+}
+
+func TestRedis_SessionKeyRing(t *testing.T) {
+	tester.KeyRing(t, func(t *testing.T, ring *sessions.KeyRing) sessions.Store {
+		store := newRedisStore(t)
+		rediStore, err := GetRedisStore(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rediStore.Codecs = ring.Codecs()
+		return store
+	})
+}
+
 func TestGetRedisStore(t *testing.T) {
 	t.Run("unmatched type", func(t *testing.T) {
 		type store struct{ Store }
@@ -90,3 +134,15 @@ func TestGetRedisStore(t *testing.T) {
 		}
 	})
 }
+
+func TestRedis_SessionTransport(t *testing.T) {
+	tester.Transport(t, func(t *testing.T, transport sessions.Transport) sessions.Store {
+		store := newRedisStore(t)
+		rediStore, err := GetRedisStore(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rediStore.SetTransport(transport)
+		return store
+	})
+}
@@ -47,13 +47,16 @@
 package redis
 
 import (
+	"context"
 	"encoding/base32"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/app"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/gorilla/securecookie"
@@ -64,6 +67,16 @@ import (
 // Amount of time for cookies/redis keys to expire.
 var sessionExpire = 86400 * 30
 
+// touchScript extends the TTL of KEYS[1] to ARGV[1] milliseconds once at
+// least ARGV[2] milliseconds have passed since it was last set.
+var touchScript = redis.NewScript(1, `
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 and tonumber(ARGV[1]) - ttl >= tonumber(ARGV[2]) then
+		return redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	end
+	return 0
+`)
+
 // RediStore stores sessions in a redis backend.
 type RediStore struct {
 	Pool          *redis.Pool
@@ -73,6 +86,15 @@ type RediStore struct {
 	maxLength     int
 	keyPrefix     string
 	serializer    hs.Serializer
+	transport     hs.Transport
+	userLimit     int
+	limitPolicy   hs.LimitPolicy
+	timeout       time.Duration
+	maxLifetime   int
+
+	rolling         bool
+	rollingInterval time.Duration
+	rollingCookie   bool
 }
 
 // SetMaxLength sets RediStore.maxLength if the `l` argument is greater or equal 0
@@ -97,6 +119,49 @@ func (s *RediStore) SetSerializer(ss hs.Serializer) {
 	s.serializer = ss
 }
 
+// SetTransport sets how the session ID travels between the client and the
+// store, in the session cookie by default. See sessions.Transport.
+func (s *RediStore) SetTransport(t hs.Transport) {
+	s.transport = t
+}
+
+// SetUserLimit caps the number of sessions bound to a user, see
+// sessions.UserIDKey, to max. Saving one more session then either fails or
+// deletes the oldest sessions of the user, according to policy. The limit
+// is enforced atomically in redis, so concurrent logins can't exceed it.
+// Set max to 0 for no limit, the default.
+func (s *RediStore) SetUserLimit(max int, policy hs.LimitPolicy) {
+	s.userLimit = max
+	s.limitPolicy = policy
+}
+
+// SetMaxLifetime caps the lifetime, in seconds, of the sessions of the store
+// counted from their creation regardless of activity. Older sessions are
+// deleted and treated as new. Set it to 0 for no restriction.
+func (s *RediStore) SetMaxLifetime(v int) {
+	s.maxLifetime = v
+}
+
+// SetTimeout sets the timeout of every redis operation issued by the store.
+// Operations are also canceled together with the request they serve.
+// Default: 0, no timeout.
+func (s *RediStore) SetTimeout(d time.Duration) {
+	s.timeout = d
+}
+
+// SetRolling enables sliding expiration. A session that was read but not
+// modified then has its TTL refreshed when the handler returns or saves it,
+// at most once per minInterval, so that active users are not logged out
+// after the session age.
+// The TTL is read along with the session, so that touching it within
+// minInterval costs no round trip.
+// With refreshCookie the cookie is sent again so its Max-Age slides too.
+func (s *RediStore) SetRolling(minInterval time.Duration, refreshCookie bool) {
+	s.rolling = true
+	s.rollingInterval = minInterval
+	s.rollingCookie = refreshCookie
+}
+
 // SetMaxAge restricts the maximum age, in seconds, of the session record
 // both in database and a browser. This is to change session storage configuration.
 // If you want just to remove session use your session `s` object and change it's
@@ -109,25 +174,17 @@ func (s *RediStore) SetSerializer(ss hs.Serializer) {
 // Because we use `MaxAge` also in SecureCookie crypting algorithm you should
 // use this function to change `MaxAge` value.
 func (s *RediStore) SetMaxAge(v int) {
-	var c *securecookie.SecureCookie
-	var ok bool
 	s.Options.MaxAge = v
-	for i := range s.Codecs {
-		if c, ok = s.Codecs[i].(*securecookie.SecureCookie); ok {
-			c.MaxAge(v)
-		} else {
-			hlog.Warnf("Can't change MaxAge on codec %v\n", s.Codecs[i])
-		}
-	}
+	hs.SetCodecsMaxAge(s.Codecs, v)
 }
 
-func dial(network, address, password string) (redis.Conn, error) {
-	c, err := redis.Dial(network, address)
+func dial(ctx context.Context, network, address, password string) (redis.Conn, error) {
+	c, err := redis.DialContext(ctx, network, address)
 	if err != nil {
 		return nil, err
 	}
 	if password != "" {
-		if _, err := c.Do("AUTH", password); err != nil {
+		if _, err := redis.DoContext(c, ctx, "AUTH", password); err != nil {
 			c.Close()
 			return nil, err
 		}
@@ -145,18 +202,18 @@ func NewRediStore(size int, network, address, password string, keyPairs ...[]byt
 			_, err := c.Do("PING")
 			return err
 		},
-		Dial: func() (redis.Conn, error) {
-			return dial(network, address, password)
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return dial(ctx, network, address, password)
 		},
 	}, keyPairs...)
 }
 
-func dialWithDB(network, address, password, DB string) (redis.Conn, error) {
-	c, err := dial(network, address, password)
+func dialWithDB(ctx context.Context, network, address, password, DB string) (redis.Conn, error) {
+	c, err := dial(ctx, network, address, password)
 	if err != nil {
 		return nil, err
 	}
-	if _, err := c.Do("SELECT", DB); err != nil {
+	if _, err := redis.DoContext(c, ctx, "SELECT", DB); err != nil {
 		c.Close()
 		return nil, err
 	}
@@ -173,8 +230,80 @@ func NewRediStoreWithDB(size int, network, address, password, DB string, keyPair
 			_, err := c.Do("PING")
 			return err
 		},
-		Dial: func() (redis.Conn, error) {
-			return dialWithDB(network, address, password, DB)
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return dialWithDB(ctx, network, address, password, DB)
+		},
+	}, keyPairs...)
+}
+
+// masterAddr asks the sentinels in turn for the address of the current master.
+func masterAddr(ctx context.Context, masterName string, sentinelAddrs []string) (string, error) {
+	err := errors.New("redis: no sentinel address given")
+	for _, addr := range sentinelAddrs {
+		var c redis.Conn
+		c, err = redis.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			continue
+		}
+		var res []string
+		res, err = redis.Strings(redis.DoContext(c, ctx, "SENTINEL", "get-master-addr-by-name", masterName))
+		c.Close()
+		if err == nil && len(res) == 2 {
+			return net.JoinHostPort(res[0], res[1]), nil
+		}
+		if err == nil || err == redis.ErrNil {
+			err = fmt.Errorf("redis: sentinel %s does not know master %q", addr, masterName)
+		}
+	}
+	return "", err
+}
+
+// isMaster reports whether c is connected to a redis master.
+func isMaster(ctx context.Context, c redis.Conn) error {
+	res, err := redis.Values(redis.DoContext(c, ctx, "ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		return errors.New("redis: empty ROLE reply")
+	}
+	if role, _ := redis.String(res[0], nil); role != "master" {
+		return fmt.Errorf("redis: connected to a %s instead of the master", role)
+	}
+	return nil
+}
+
+func dialSentinel(ctx context.Context, masterName string, sentinelAddrs []string, password string) (redis.Conn, error) {
+	addr, err := masterAddr(ctx, masterName, sentinelAddrs)
+	if err != nil {
+		return nil, err
+	}
+	c, err := dial(ctx, "tcp", addr, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := isMaster(ctx, c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewRediStoreWithSentinel returns a new RediStore connected to the master
+// the given sentinels monitor under masterName.
+// The master is looked up again whenever a connection is dialed, and idle
+// connections to a demoted master are dropped when borrowed, so the store
+// follows failovers.
+// size: maximum number of idle connections.
+func NewRediStoreWithSentinel(size int, masterName string, sentinelAddrs []string, password string, keyPairs ...[]byte) (*RediStore, error) {
+	return NewRediStoreWithPool(&redis.Pool{
+		MaxIdle:     size,
+		IdleTimeout: 240 * time.Second,
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			return isMaster(context.Background(), c)
+		},
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return dialSentinel(ctx, masterName, sentinelAddrs, password)
 		},
 	}, keyPairs...)
 }
@@ -193,6 +322,7 @@ func NewRediStoreWithPool(pool *redis.Pool, keyPairs ...[]byte) (*RediStore, err
 		maxLength:     4096,
 		keyPrefix:     "session_",
 		serializer:    hs.GobSerializer{},
+		transport:     hs.CookieTransport{},
 	}
 	_, err := rs.ping()
 	return rs, err
@@ -214,6 +344,17 @@ func (s *RediStore) Get(r *http.Request, name string) (*sessions.Session, error)
 //
 // See gorilla/sessions FilesystemStore.New().
 func (s *RediStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	return s.newSession(r.Context(), hs.HTTPCarrier(r, nil), name)
+}
+
+// GetHertz returns a session for the given name, reading its ID from the
+// Hertz request.
+func (s *RediStore) GetHertz(ctx context.Context, c *app.RequestContext, name string) (*sessions.Session, error) {
+	return s.newSession(ctx, hs.HertzCarrier(c), name)
+}
+
+// newSession loads the session whose ID the transport reads.
+func (s *RediStore) newSession(ctx context.Context, carrier hs.Carrier, name string) (*sessions.Session, error) {
 	var (
 		err error
 		ok  bool
@@ -223,38 +364,120 @@ func (s *RediStore) New(r *http.Request, name string) (*sessions.Session, error)
 	options := *s.Options
 	session.Options = &options
 	session.IsNew = true
-	if c, errCookie := r.Cookie(name); errCookie == nil {
-		err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
+	if value, found := s.transport.Token(carrier, name); found {
+		err = hs.DecodeCookie(ctx, name, value, &session.ID, s.Codecs...)
 		if err == nil {
-			ok, err = s.load(session)
+			ok, err = s.load(ctx, session)
 			session.IsNew = !(err == nil && ok) // not new if no error and data available
 		}
 	}
+	if err == nil && hs.LifetimeExceeded(session, s.maxLifetime) {
+		// The session outlived its absolute lifetime, start over.
+		if err = s.delete(ctx, session); err != nil {
+			return session, err
+		}
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+	}
+	if s.maxLifetime > 0 {
+		hs.StampCreated(session)
+	}
 	return session, err
 }
 
 // Save adds a single session to the response.
 func (s *RediStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	return s.saveSession(r.Context(), hs.HTTPCarrier(r, w), session)
+}
+
+// SaveHertz saves the session and sends its ID on the Hertz response.
+func (s *RediStore) SaveHertz(ctx context.Context, c *app.RequestContext, session *sessions.Session) error {
+	return s.saveSession(ctx, hs.HertzCarrier(c), session)
+}
+
+// saveSession stores the session and sends its ID with the transport.
+func (s *RediStore) saveSession(ctx context.Context, carrier hs.Carrier, session *sessions.Session) error {
 	// Marked for deletion.
 	if session.Options.MaxAge <= 0 {
-		if err := s.delete(session); err != nil {
+		if err := s.delete(ctx, session); err != nil {
 			return err
 		}
-		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		s.transport.SetToken(carrier, session.Name(), "", session.Options)
 	} else {
 		// Build an alphanumeric key for the redis store.
 		if session.ID == "" {
 			session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
 		}
-		if err := s.save(session); err != nil {
+		if err := s.save(ctx, session); err != nil {
 			return err
 		}
 		encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
 		if err != nil {
 			return err
 		}
-		http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+		s.transport.SetToken(carrier, session.Name(), encoded, session.Options)
+	}
+	return nil
+}
+
+// Touch refreshes the TTL of a session that was read but not modified
+// when sliding expiration is enabled. See SetRolling.
+func (s *RediStore) Touch(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	return s.touchSession(r.Context(), hs.HTTPCarrier(r, w), session)
+}
+
+// TouchHertz is Touch for the Hertz response.
+func (s *RediStore) TouchHertz(ctx context.Context, c *app.RequestContext, session *sessions.Session) error {
+	return s.touchSession(ctx, hs.HertzCarrier(c), session)
+}
+
+// touchSession refreshes the TTL of the session, and its ID if enabled.
+func (s *RediStore) touchSession(ctx context.Context, carrier hs.Carrier, session *sessions.Session) error {
+	if !s.rolling || session.IsNew || session.ID == "" || session.Options.MaxAge < 0 {
+		return nil
+	}
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	if !hs.TouchDue(session, time.Duration(age)*time.Second, s.rollingInterval) {
+		return nil
+	}
+	touched, err := s.touch(ctx, session, time.Duration(age)*time.Second)
+	if err != nil || !touched {
+		return err
+	}
+	hs.StampTTL(session, time.Duration(age)*time.Second)
+	if !s.rollingCookie {
+		return nil
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	s.transport.SetToken(carrier, session.Name(), encoded, session.Options)
+	return nil
+}
+
+// Regenerate removes the session from redis and clears its ID,
+// so that the next Save stores the values under a fresh ID.
+func (s *RediStore) Regenerate(r *http.Request, session *sessions.Session) error {
+	return s.regenerate(r.Context(), session)
+}
+
+// RegenerateHertz is Regenerate for the Hertz request.
+func (s *RediStore) RegenerateHertz(ctx context.Context, _ *app.RequestContext, session *sessions.Session) error {
+	return s.regenerate(ctx, session)
+}
+
+func (s *RediStore) regenerate(ctx context.Context, session *sessions.Session) error {
+	if session.ID != "" {
+		if err := s.delete(ctx, session); err != nil {
+			return err
+		}
 	}
+	session.ID = ""
 	return nil
 }
 
@@ -263,15 +486,13 @@ func (s *RediStore) Save(r *http.Request, w http.ResponseWriter, session *sessio
 // WARNING: This method should be considered deprecated since it is not exposed via the gorilla/sessions interface.
 // Set session.Options.MaxAge = -1 and call Save instead. - July 18th, 2013
 func (s *RediStore) Delete(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
-	conn := s.Pool.Get()
-	defer conn.Close()
-	if _, err := conn.Do("DEL", s.keyPrefix+session.ID); err != nil {
+	if err := s.delete(r.Context(), session); err != nil {
 		return err
 	}
 	// Set cookie to expire.
 	options := *session.Options
 	options.MaxAge = -1
-	http.SetCookie(w, sessions.NewCookie(session.Name(), "", &options))
+	s.transport.SetToken(hs.HTTPCarrier(r, w), session.Name(), "", &options)
 	// Clear session values.
 	for k := range session.Values {
 		delete(session.Values, k)
@@ -290,8 +511,17 @@ func (s *RediStore) ping() (bool, error) {
 	return (data == "PONG"), nil
 }
 
+// withTimeout bounds ctx by the operation timeout of the store, if any.
+func (s *RediStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(ctx, s.timeout)
+	}
+	return ctx, func() {}
+}
+
 // save stores the session in redis.
-func (s *RediStore) save(session *sessions.Session) error {
+func (s *RediStore) save(ctx context.Context, session *sessions.Session) error {
+	hs.UnstampTTL(session)
 	b, err := s.serializer.Serialize(session)
 	if err != nil {
 		return err
@@ -299,30 +529,66 @@ func (s *RediStore) save(session *sessions.Session) error {
 	if s.maxLength != 0 && len(b) > s.maxLength {
 		return errors.New("SessionStore: the value to store is too big")
 	}
-	conn := s.Pool.Get()
-	defer conn.Close()
-	if err = conn.Err(); err != nil {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	conn, err := s.Pool.GetContext(ctx)
+	if err != nil {
 		return err
 	}
+	defer conn.Close()
 	age := session.Options.MaxAge
 	if age == 0 {
 		age = s.DefaultMaxAge
 	}
-	_, err = conn.Do("SETEX", s.keyPrefix+session.ID, age, b)
-	return err
+	// admit the session in the index of its user first, which may be full
+	evicted, err := s.index(ctx, conn, session, time.Duration(age)*time.Second, s.userLimit)
+	if err != nil {
+		return err
+	}
+	if _, err = redis.DoContext(conn, ctx, "SETEX", s.keyPrefix+session.ID, age, b); err != nil {
+		return err
+	}
+	return s.evict(ctx, conn, evicted)
+}
+
+// touch extends the TTL of the session to age, unless it was already
+// refreshed within the rolling interval. Returns true if the TTL was extended.
+func (s *RediStore) touch(ctx context.Context, session *sessions.Session, age time.Duration) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	conn, err := s.Pool.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	n, err := redis.Int(touchScript.DoContext(ctx, conn, s.keyPrefix+session.ID, age.Milliseconds(), s.rollingInterval.Milliseconds()))
+	if err != nil || n != 1 {
+		return false, err
+	}
+	_, err = s.index(ctx, conn, session, age, 0)
+	return true, err
 }
 
 // load reads the session from redis.
 // returns true if there is a sessoin data in DB
-func (s *RediStore) load(session *sessions.Session) (bool, error) {
-	conn := s.Pool.Get()
+func (s *RediStore) load(ctx context.Context, session *sessions.Session) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	conn, err := s.Pool.GetContext(ctx)
+	if err != nil {
+		return false, hs.Unavailable(err)
+	}
 	defer conn.Close()
-	if err := conn.Err(); err != nil {
-		return false, err
+	var data interface{}
+	var ttl int64
+	if s.rolling {
+		// read the TTL along, to touch the session only once it is due
+		data, ttl, err = s.getWithTTL(ctx, conn, s.keyPrefix+session.ID)
+	} else {
+		data, err = redis.DoContext(conn, ctx, "GET", s.keyPrefix+session.ID)
 	}
-	data, err := conn.Do("GET", s.keyPrefix+session.ID)
 	if err != nil {
-		return false, err
+		return false, hs.Unavailable(err)
 	}
 	if data == nil {
 		return false, nil // no data was associated with this key
@@ -331,24 +597,52 @@ func (s *RediStore) load(session *sessions.Session) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	return true, s.serializer.Deserialize(b, session)
+	if err = s.serializer.Deserialize(b, session); err != nil {
+		return true, err
+	}
+	if s.rolling {
+		hs.StampTTL(session, time.Duration(ttl)*time.Millisecond)
+	}
+	return true, nil
+}
+
+// getWithTTL pipelines a GET and a PTTL of key.
+func (s *RediStore) getWithTTL(ctx context.Context, conn redis.Conn, key string) (interface{}, int64, error) {
+	if err := conn.Send("GET", key); err != nil {
+		return nil, 0, err
+	}
+	if err := conn.Send("PTTL", key); err != nil {
+		return nil, 0, err
+	}
+	// an empty command flushes the pipeline and receives its replies
+	replies, err := redis.Values(redis.DoContext(conn, ctx, ""))
+	if err != nil {
+		return nil, 0, err
+	}
+	ttl, err := redis.Int64(replies[1], nil)
+	return replies[0], ttl, err
 }
 
 // delete removes keys from redis if MaxAge<0
-func (s *RediStore) delete(session *sessions.Session) error {
-	conn := s.Pool.Get()
+func (s *RediStore) delete(ctx context.Context, session *sessions.Session) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	conn, err := s.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
-	if _, err := conn.Do("DEL", s.keyPrefix+session.ID); err != nil {
+	if _, err := redis.DoContext(conn, ctx, "DEL", s.keyPrefix+session.ID); err != nil {
 		return err
 	}
-	return nil
+	return s.unindex(ctx, conn, session)
 }
 
 // LoadSessionBySessionId Get session using session_id even without a context
 func LoadSessionBySessionId(s *RediStore, sessionId string) (*sessions.Session, error) {
 	var session sessions.Session
 	session.ID = sessionId
-	exist, err := s.load(&session)
+	exist, err := s.load(context.Background(), &session)
 	if err != nil {
 		return nil, err
 	}
@@ -361,5 +655,5 @@ func LoadSessionBySessionId(s *RediStore, sessionId string) (*sessions.Session,
 // SaveSessionWithoutContext Save session even without a context
 func SaveSessionWithoutContext(s *RediStore, sessionId string, session *sessions.Session) error {
 	session.ID = sessionId
-	return s.save(session)
+	return s.save(context.Background(), session)
 }
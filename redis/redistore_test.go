@@ -48,12 +48,30 @@ package redis
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/gob"
+	"errors"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/gomodule/redigo/redis"
+	"github.com/gorilla/securecookie"
 	hs "github.com/hertz-contrib/sessions"
 
 	"github.com/gorilla/sessions"
@@ -462,6 +480,277 @@ func TestRediStore(t *testing.T) {
 	}
 }
 
+func TestMsgPackSerializer(t *testing.T) {
+	store, err := NewRediStore(10, "tcp", setup(), "", []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+	store.SetSerializer(hs.MsgPackSerializer{})
+
+	now := time.Now()
+	session := sessions.NewSession(store, "session-key")
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values[1] = "int key"
+	session.Values["int"] = 42
+	session.Values["float"] = 1.5
+	session.Values["bytes"] = []byte("bytes")
+	session.Values["time"] = now
+	session.Values[uint64(math.MaxUint64)] = "big key"
+	session.Values["nested"] = map[interface{}]interface{}{2: []interface{}{int8(3)}}
+	session.Values["struct"] = map[string]interface{}{"a": int8(1)}
+	if err = SaveSessionWithoutContext(store, "msgpack", session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	s := sessions.NewSession(store, "session-key")
+	s.ID = "msgpack"
+	if _, err = store.load(context.Background(), s); err != nil {
+		t.Fatalf("Error loading session: %v", err)
+	}
+	if s.Values[1] != "int key" {
+		t.Errorf("Expected int key; Got %#v", s.Values[1])
+	}
+	if s.Values["int"] != int64(42) {
+		t.Errorf("Expected int64 42; Got %#v", s.Values["int"])
+	}
+	if s.Values["float"] != 1.5 {
+		t.Errorf("Expected float64 1.5; Got %#v", s.Values["float"])
+	}
+	if b, ok := s.Values["bytes"].([]byte); !ok || string(b) != "bytes" {
+		t.Errorf("Expected []byte; Got %#v", s.Values["bytes"])
+	}
+	if tm, ok := s.Values["time"].(time.Time); !ok || !tm.Equal(now) {
+		t.Errorf("Expected %v; Got %#v", now, s.Values["time"])
+	}
+	if s.Values[uint64(math.MaxUint64)] != "big key" {
+		t.Errorf("Expected uint64 key; Got %#v", s.Values)
+	}
+	if m, ok := s.Values["nested"].(map[interface{}]interface{}); !ok || !reflect.DeepEqual(m[2], []interface{}{int64(3)}) {
+		t.Errorf("Expected nested map with int key; Got %#v", s.Values["nested"])
+	}
+	if !reflect.DeepEqual(s.Values["struct"], map[string]interface{}{"a": int64(1)}) {
+		t.Errorf("Expected nested map with string key; Got %#v", s.Values["struct"])
+	}
+}
+
+func TestGzipSerializer(t *testing.T) {
+	store, err := NewRediStore(10, "tcp", setup(), "", []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+
+	session := sessions.NewSession(store, "session-key")
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values["cart"] = strings.Repeat("item,", 2000)
+
+	// a legacy record written before compression was enabled
+	if err = SaveSessionWithoutContext(store, "legacy", session); err == nil {
+		t.Fatal("Expected error saving a session over maxLength")
+	}
+	store.SetMaxLength(0)
+	if err = SaveSessionWithoutContext(store, "legacy", session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	store.SetMaxLength(4096)
+	store.SetSerializer(hs.GzipSerializer{Threshold: 1024})
+	if err = SaveSessionWithoutContext(store, "gzip", session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	store.SetSerializer(hs.GzipSerializer{Level: hs.GzipNoCompression})
+	if err = SaveSessionWithoutContext(store, "stored", session); err == nil {
+		t.Fatal("Expected error saving an uncompressed session over maxLength")
+	}
+	store.SetSerializer(hs.GzipSerializer{Threshold: 1024})
+
+	for _, id := range []string{"legacy", "gzip"} {
+		s := sessions.NewSession(store, "session-key")
+		s.ID = id
+		if _, err = store.load(context.Background(), s); err != nil {
+			t.Fatalf("Error loading session %s: %v", id, err)
+		}
+		if s.Values["cart"] != session.Values["cart"] {
+			t.Errorf("Expected the cart of session %s to be kept", id)
+		}
+	}
+}
+
+func TestAEADSerializer(t *testing.T) {
+	store, err := NewRediStore(10, "tcp", setup(), "", []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+
+	oldKey := hs.AEADKey{ID: "2023", Key: bytes.Repeat([]byte{1}, 32)}
+	newKey := hs.AEADKey{ID: "2024", Key: bytes.Repeat([]byte{2}, 16)}
+	serializer, err := hs.NewAEADSerializer(hs.JSONSerializer{}, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetSerializer(serializer)
+
+	session := sessions.NewSession(store, "session-key")
+	session.Options = &sessions.Options{MaxAge: 60}
+	session.Values["secret"] = "plaintext"
+	if err = SaveSessionWithoutContext(store, "aead", session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	conn := store.Pool.Get()
+	b, err := redis.Bytes(conn.Do("GET", "session_aead"))
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("plaintext")) {
+		t.Error("Expected the session values to be encrypted")
+	}
+
+	load := func(id string) error {
+		s := sessions.NewSession(store, "session-key")
+		s.ID = id
+		_, err := store.load(context.Background(), s)
+		if err == nil && s.Values["secret"] != "plaintext" {
+			t.Errorf("Expected plaintext; Got %v", s.Values["secret"])
+		}
+		return err
+	}
+
+	// rotate: the new key encrypts, the old one still decrypts
+	serializer, err = hs.NewAEADSerializer(hs.JSONSerializer{}, newKey, oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetSerializer(serializer)
+	if err = load("aead"); err != nil {
+		t.Fatalf("Error loading session encrypted with the old key: %v", err)
+	}
+	if err = SaveSessionWithoutContext(store, "aead", session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	// drop the old key
+	serializer, err = hs.NewAEADSerializer(hs.JSONSerializer{}, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.SetSerializer(serializer)
+	if err = load("aead"); err != nil {
+		t.Fatalf("Error loading session encrypted with the new key: %v", err)
+	}
+
+	// records moved under another ID or encrypted with unknown keys are rejected
+	conn = store.Pool.Get()
+	_, err = conn.Do("SET", "session_moved", b)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = load("moved"); !errors.Is(err, hs.ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for an unknown key; Got %v", err)
+	}
+	if err = SaveSessionWithoutContext(store, "moved", session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	conn = store.Pool.Get()
+	b, _ = redis.Bytes(conn.Do("GET", "session_moved"))
+	_, err = conn.Do("SET", "session_other", b)
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = load("other"); !errors.Is(err, hs.ErrDecrypt) {
+		t.Errorf("Expected ErrDecrypt for a record moved to another ID; Got %v", err)
+	}
+
+	if _, err = hs.NewAEADSerializer(nil, hs.AEADKey{ID: "short", Key: []byte("short")}); err == nil {
+		t.Error("Expected error for an invalid AES key")
+	}
+	if _, err = hs.NewAEADSerializer(nil, newKey, newKey); err == nil {
+		t.Error("Expected error for duplicate key IDs")
+	}
+}
+
+func TestVersionedSerializer(t *testing.T) {
+	store, err := NewRediStore(10, "tcp", setup(), "", []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+
+	save := func(id string, values map[interface{}]interface{}) {
+		session := sessions.NewSession(store, "session-key")
+		session.Options = &sessions.Options{MaxAge: 60}
+		session.Values = values
+		if err := SaveSessionWithoutContext(store, id, session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+	}
+	load := func(id string) (map[interface{}]interface{}, error) {
+		session := sessions.NewSession(store, "session-key")
+		session.ID = id
+		_, err := store.load(context.Background(), session)
+		return session.Values, err
+	}
+
+	// version 0: records of the default gob serializer, keyed by "name"
+	save("v0", map[interface{}]interface{}{"name": "gopher"})
+	// version 1: gob, keyed by "user"
+	store.SetSerializer(hs.NewVersionedSerializer(1, hs.GobSerializer{}))
+	save("v1", map[interface{}]interface{}{"user": "gopher"})
+
+	// version 2: JSON, with a "role"
+	v2 := hs.NewVersionedSerializer(2, hs.JSONSerializer{}).
+		Register(0, hs.GobSerializer{}, func(values map[interface{}]interface{}) error {
+			values["user"] = values["name"]
+			delete(values, "name")
+			return nil
+		}).
+		Register(1, hs.GobSerializer{}, func(values map[interface{}]interface{}) error {
+			values["role"] = "member"
+			return nil
+		})
+	store.SetSerializer(v2)
+	save("v2", map[interface{}]interface{}{"user": "gopher", "role": "admin"})
+
+	for id, role := range map[string]string{"v0": "member", "v1": "member", "v2": "admin"} {
+		values, err := load(id)
+		if err != nil {
+			t.Fatalf("Error loading session %s: %v", id, err)
+		}
+		if len(values) != 2 || values["user"] != "gopher" || values["role"] != role {
+			t.Errorf("Unexpected values for session %s: %v", id, values)
+		}
+	}
+
+	// the migrated record is written back as JSON
+	values, _ := load("v0")
+	save("v0", values)
+	store.SetSerializer(hs.NewVersionedSerializer(2, hs.JSONSerializer{}))
+	if _, err = load("v0"); err != nil {
+		t.Fatalf("Error loading migrated session: %v", err)
+	}
+	if _, err = load("v1"); err == nil {
+		t.Error("Expected error loading a record without migration")
+	}
+	store.SetSerializer(hs.NewVersionedSerializer(1, hs.JSONSerializer{}))
+	if _, err = load("v2"); err == nil {
+		t.Error("Expected error loading a record of a newer version")
+	}
+
+	// a version registered without serializer is read with the current one
+	store.SetSerializer(hs.NewVersionedSerializer(3, hs.JSONSerializer{}).
+		Register(2, nil, func(values map[interface{}]interface{}) error {
+			values["role"] = "owner"
+			return nil
+		}))
+	if values, err = load("v2"); err != nil || values["role"] != "owner" {
+		t.Errorf("Unexpected values for session v2: %v, %v", values, err)
+	}
+}
+
 func TestPingGoodPort(t *testing.T) {
 	store, _ := NewRediStore(10, "tcp", ":6379", "", []byte("secret-key"))
 	defer store.Close()
@@ -483,6 +772,301 @@ func TestPingBadPort(t *testing.T) {
 	}
 }
 
+func TestRequestContext(t *testing.T) {
+	store, err := NewRediStore(10, "tcp", setup(), "", []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://localhost:8080/", nil)
+	session := sessions.NewSession(store, "session-key")
+	session.Options = &sessions.Options{MaxAge: 60}
+	if err = store.Save(req, NewRecorder(), session); err == nil {
+		t.Fatal("Expected an error saving with an expired request context")
+	}
+
+	store.SetTimeout(time.Nanosecond)
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	if err = store.Save(req, NewRecorder(), session); err == nil {
+		t.Fatal("Expected an error saving past the operation timeout")
+	}
+}
+
+func TestRolling(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rs, err := NewRediStore(10, "tcp", mr.Addr(), "", []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer rs.Close()
+	rs.SetRolling(time.Minute, false)
+	age := time.Duration(rs.Options.MaxAge) * time.Second
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session := sessions.NewSession(rs, "session-key")
+	session.Options = &sessions.Options{MaxAge: rs.Options.MaxAge}
+	session.Values["key"] = "val"
+	if err = rs.Save(req, NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+
+	mr.FastForward(30 * time.Second)
+	if err = rs.Touch(req, NewRecorder(), session); err != nil {
+		t.Fatalf("Error touching session: %v", err)
+	}
+	if ttl := mr.TTL("session_" + session.ID); ttl != age-30*time.Second {
+		t.Fatalf("Expected the TTL to be kept within the rolling interval, got %v", ttl)
+	}
+
+	// The TTL read along with a loaded session spares the touch a round trip.
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, rs.Codecs...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	loadReq, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	loadReq.Header.Add("Cookie", "session-key="+encoded)
+	loaded, err := rs.New(loadReq, "session-key")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("Expected the session to be loaded, got %v", err)
+	}
+	commands := mr.CommandCount()
+	if err = rs.Touch(loadReq, NewRecorder(), loaded); err != nil {
+		t.Fatalf("Error touching session: %v", err)
+	}
+	if n := mr.CommandCount() - commands; n != 0 {
+		t.Fatalf("Expected no command touching within the rolling interval, got %d", n)
+	}
+
+	mr.FastForward(time.Minute)
+	rsp := NewRecorder()
+	if err = rs.Touch(req, rsp, session); err != nil {
+		t.Fatalf("Error touching session: %v", err)
+	}
+	if ttl := mr.TTL("session_" + session.ID); ttl != age {
+		t.Fatalf("Expected the TTL to be refreshed, got %v", ttl)
+	}
+	if len(rsp.Header()["Set-Cookie"]) != 0 {
+		t.Fatal("Expected no cookie to be sent")
+	}
+
+	// The middleware touches a session read by the handler without Save.
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	r.Use(hs.New("session-key", &store{rs}))
+	r.GET("/", func(ctx context.Context, c *app.RequestContext) {
+		if hs.Default(c).Get("key") != "val" {
+			t.Error("Expected the session to be loaded")
+		}
+	})
+	mr.FastForward(time.Minute)
+	ut.PerformRequest(r, consts.MethodGet, "/", nil, ut.Header{Key: "Cookie", Value: "session-key=" + encoded})
+	if ttl := mr.TTL("session_" + session.ID); ttl != age {
+		t.Fatalf("Expected the TTL to be refreshed by the middleware, got %v", ttl)
+	}
+}
+
+func TestUserSessions(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewRediStore(10, "tcp", mr.Addr(), "", []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	save := func(userID string, maxAge int) *sessions.Session {
+		session := sessions.NewSession(store, "session-key")
+		session.Options = &sessions.Options{MaxAge: maxAge}
+		if userID != "" {
+			session.Values[hs.UserIDKey] = userID
+		}
+		if err := store.Save(req, NewRecorder(), session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+		return session
+	}
+	short, deleted, long := save("42", 60), save("42", 3600), save("42", 3600)
+	save("7", 3600)
+	save("", 3600)
+
+	list, err := store.ListUserSessions(ctx, "42")
+	if err != nil || len(list) != 3 {
+		t.Fatalf("Expected 3 sessions, got %d, %v", len(list), err)
+	}
+
+	deleted.Options.MaxAge = -1
+	if err = store.Save(req, NewRecorder(), deleted); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	if ids, _ := mr.ZMembers("session_user_42"); len(ids) != 2 {
+		t.Fatalf("Expected the deleted session to leave the index, got %v", ids)
+	}
+
+	mr.FastForward(2 * time.Minute)
+	list, err = store.ListUserSessions(ctx, "42")
+	if err != nil || len(list) != 1 || list[0].ID != long.ID || list[0].Values[hs.UserIDKey] != "42" {
+		t.Fatalf("Expected the live session only, got %v, %v", list, err)
+	}
+	if ids, _ := mr.ZMembers("session_user_42"); len(ids) != 1 || ids[0] == short.ID {
+		t.Fatalf("Expected the expired session to be pruned, got %v", ids)
+	}
+
+	n, err := store.RevokeUserSessions(ctx, "42")
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 revoked session, got %d, %v", n, err)
+	}
+	if session, _ := LoadSessionBySessionId(store, long.ID); session != nil {
+		t.Fatal("Expected the revoked session to be deleted")
+	}
+	if list, _ = store.ListUserSessions(ctx, "7"); len(list) != 1 {
+		t.Fatalf("Expected the sessions of other users to be kept, got %v", list)
+	}
+	if ttl := mr.TTL("session_user_7"); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("Expected the index to expire with its last session, got %v", ttl)
+	}
+}
+
+func TestUserLimit(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store, err := NewRediStore(10, "tcp", mr.Addr(), "", []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+	store.SetUserLimit(2, hs.RejectNewSession)
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	save := func(userID string, maxAge int) (*sessions.Session, *ResponseRecorder, error) {
+		session := sessions.NewSession(store, "session-key")
+		session.Options = &sessions.Options{MaxAge: maxAge}
+		session.Values[hs.UserIDKey] = userID
+		rsp := NewRecorder()
+		return session, rsp, store.Save(req, rsp, session)
+	}
+	first, _, _ := save("42", 60)
+	second, _, _ := save("42", 3600)
+	rejected, rsp, err := save("42", 3600)
+	if !errors.Is(err, hs.ErrSessionLimit) {
+		t.Fatalf("Expected ErrSessionLimit, got %v", err)
+	}
+	if mr.Exists("session_"+rejected.ID) || len(rsp.Header()["Set-Cookie"]) != 0 {
+		t.Fatal("Expected the rejected session to be neither stored nor sent")
+	}
+	if _, _, err = save("7", 3600); err != nil {
+		t.Fatalf("Expected the sessions of other users to be kept apart, got %v", err)
+	}
+	if err = store.Save(req, NewRecorder(), first); err != nil {
+		t.Fatalf("Expected a session of the user to be saved again, got %v", err)
+	}
+
+	// a session bound to another user meanwhile no longer counts
+	second.Values[hs.UserIDKey] = "7"
+	if err = store.Save(req, NewRecorder(), second); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	if _, _, err = save("42", 3600); err != nil {
+		t.Fatalf("Expected the stale session to be pruned, got %v", err)
+	}
+
+	store.SetUserLimit(2, hs.EvictOldestSession)
+	kept, _, err := save("42", 3600)
+	if err != nil {
+		t.Fatalf("Expected the oldest session to be evicted, got %v", err)
+	}
+	if session, _ := LoadSessionBySessionId(store, first.ID); session != nil {
+		t.Fatal("Expected the session expiring first to be deleted")
+	}
+	list, err := store.ListUserSessions(context.Background(), "42")
+	if err != nil || len(list) != 2 || (list[0].ID != kept.ID && list[1].ID != kept.ID) {
+		t.Fatalf("Expected 2 sessions with the new one, got %v, %v", list, err)
+	}
+
+	// concurrent logins can't exceed the limit
+	store.SetUserLimit(3, hs.RejectNewSession)
+	var wg sync.WaitGroup
+	var saved int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := save("13", 3600); err == nil {
+				atomic.AddInt32(&saved, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if saved != 3 {
+		t.Fatalf("Expected 3 concurrent sessions to be saved, got %d", saved)
+	}
+}
+
+// runRole starts a miniredis answering ROLE with the role stored in role.
+func runRole(t *testing.T, role *atomic.Value) *miniredis.Miniredis {
+	m := miniredis.RunT(t)
+	_ = m.Server().Register("ROLE", func(c *server.Peer, cmd string, args []string) {
+		c.WriteLen(3)
+		c.WriteBulk(role.Load().(string))
+		c.WriteInt(0)
+		c.WriteLen(0)
+	})
+	return m
+}
+
+func TestSentinel(t *testing.T) {
+	var role1, role2, master atomic.Value
+	role1.Store("master")
+	role2.Store("slave")
+	m1 := runRole(t, &role1)
+	m2 := runRole(t, &role2)
+	master.Store(m1.Addr())
+
+	sentinel := miniredis.RunT(t)
+	_ = sentinel.Server().Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		if len(args) != 2 || args[0] != "get-master-addr-by-name" || args[1] != "mymaster" {
+			c.WriteNull()
+			return
+		}
+		host, port, _ := net.SplitHostPort(master.Load().(string))
+		c.WriteStrings([]string{host, port})
+	})
+
+	_, err := NewRediStoreWithSentinel(10, "unknown", []string{sentinel.Addr()}, "", []byte("secret-key"))
+	if err == nil {
+		t.Fatal("Expected an error for an unknown master")
+	}
+
+	store, err := NewRediStoreWithSentinel(10, "mymaster", []string{"localhost:6378", sentinel.Addr()}, "", []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+	store.SetKeyPrefix("sentinel_")
+
+	save := func(id string) {
+		session := sessions.NewSession(store, "session-key")
+		session.Values["key"] = "val"
+		if err := SaveSessionWithoutContext(store, id, session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+	}
+	save("before")
+	if !m1.Exists("sentinel_before") {
+		t.Fatal("Expected the session to be stored on the first master")
+	}
+
+	// Fail over to the second instance.
+	role1.Store("slave")
+	role2.Store("master")
+	master.Store(m2.Addr())
+	save("after")
+	if !m2.Exists("sentinel_after") || m1.Exists("sentinel_after") {
+		t.Fatal("Expected the session to be stored on the new master")
+	}
+}
+
 func ExampleRediStore() {
 	// RedisStore
 	store, err := NewRediStore(10, "tcp", ":6379", "", []byte("secret-key"))
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/gorilla/sessions"
+	hs "github.com/hertz-contrib/sessions"
+)
+
+// indexScript adds the session ARGV[1], expiring at ARGV[2], to the user
+// index KEYS[1], a sorted set scored by expiration time in Unix milliseconds.
+// It drops the sessions expired at ARGV[3], and keeps the index as long as
+// its last session.
+//
+// A session not indexed yet is only added while the index holds less than
+// ARGV[4] sessions, unless ARGV[4] is 0: otherwise the script returns nil,
+// or evicts the sessions expiring first if ARGV[5] is 1. It returns the IDs
+// of the evicted sessions, whose records are left to the caller.
+var indexScript = redis.NewScript(1, `
+	redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+	local evicted = {}
+	local limit = tonumber(ARGV[4])
+	if limit > 0 and not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+		local n = redis.call('ZCARD', KEYS[1])
+		if n >= limit then
+			if ARGV[5] ~= '1' then
+				return false
+			end
+			evicted = redis.call('ZRANGE', KEYS[1], 0, n - limit)
+			redis.call('ZREMRANGEBYRANK', KEYS[1], 0, n - limit)
+		end
+	end
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+	local last = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+	redis.call('PEXPIREAT', KEYS[1], last[2])
+	return evicted
+`)
+
+// unixMilli returns t in Unix milliseconds, as time.Time.UnixMilli which
+// needs Go 1.17.
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// userKey returns the key of the index of the sessions of a user.
+func (s *RediStore) userKey(userID string) string {
+	return s.keyPrefix + "user_" + userID
+}
+
+// index records the session in the index of its user, if it is bound to one,
+// and returns the IDs of the sessions evicted to keep the user under limit.
+// It fails with ErrSessionLimit if the session is rejected instead.
+func (s *RediStore) index(ctx context.Context, conn redis.Conn, session *sessions.Session, age time.Duration, limit int) ([]string, error) {
+	userID, ok := hs.BoundUser(session)
+	if !ok {
+		return nil, nil
+	}
+	evicted, err := s.runIndex(ctx, conn, userID, session, age, limit)
+	if err == redis.ErrNil {
+		// the index may hold sessions deleted or bound to another user
+		// meanwhile, which don't count: prune them and try again
+		if _, err = s.userSessions(ctx, conn, userID); err != nil {
+			return nil, err
+		}
+		evicted, err = s.runIndex(ctx, conn, userID, session, age, limit)
+	}
+	if err == redis.ErrNil {
+		return nil, hs.ErrSessionLimit
+	}
+	return evicted, err
+}
+
+func (s *RediStore) runIndex(ctx context.Context, conn redis.Conn, userID string, session *sessions.Session, age time.Duration, limit int) ([]string, error) {
+	evict := 0
+	if s.limitPolicy == hs.EvictOldestSession {
+		evict = 1
+	}
+	now := time.Now()
+	return redis.Strings(indexScript.DoContext(ctx, conn, s.userKey(userID), session.ID,
+		unixMilli(now.Add(age)), unixMilli(now), limit, evict))
+}
+
+// evict deletes the records of the sessions evicted from a user index.
+func (s *RediStore) evict(ctx context.Context, conn redis.Conn, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = s.keyPrefix + id
+	}
+	_, err := redis.DoContext(conn, ctx, "DEL", keys...)
+	return err
+}
+
+// unindex removes the session from the index of its user.
+func (s *RediStore) unindex(ctx context.Context, conn redis.Conn, session *sessions.Session) error {
+	userID, ok := hs.BoundUser(session)
+	if !ok {
+		return nil
+	}
+	_, err := redis.DoContext(conn, ctx, "ZREM", s.userKey(userID), session.ID)
+	return err
+}
+
+// ListUserSessions returns the live sessions bound to the user with
+// sessions.UserIDKey, e.g. to show the devices of the user. Like
+// LoadSessionBySessionId it doesn't need a request.
+func (s *RediStore) ListUserSessions(ctx context.Context, userID string) ([]*sessions.Session, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	conn, err := s.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return s.userSessions(ctx, conn, userID)
+}
+
+// RevokeUserSessions deletes all the sessions bound to the user, e.g. after a
+// password change, and returns how many were deleted.
+func (s *RediStore) RevokeUserSessions(ctx context.Context, userID string) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	conn, err := s.Pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	list, err := s.userSessions(ctx, conn, userID)
+	if err != nil || len(list) == 0 {
+		return 0, err
+	}
+	keys := make([]interface{}, len(list))
+	members := make([]interface{}, 0, len(list)+1)
+	members = append(members, s.userKey(userID))
+	for i, session := range list {
+		keys[i] = s.keyPrefix + session.ID
+		members = append(members, session.ID)
+	}
+	if _, err = redis.DoContext(conn, ctx, "DEL", keys...); err != nil {
+		return 0, err
+	}
+	_, err = redis.DoContext(conn, ctx, "ZREM", members...)
+	return len(list), err
+}
+
+// userSessions loads the sessions of the index of the user, and prunes the
+// index of the sessions which expired, were deleted or were bound to another
+// user since they were indexed.
+func (s *RediStore) userSessions(ctx context.Context, conn redis.Conn, userID string) ([]*sessions.Session, error) {
+	key := s.userKey(userID)
+	now := unixMilli(time.Now())
+	ids, err := redis.Strings(redis.DoContext(conn, ctx, "ZRANGEBYSCORE", key, now, "+inf"))
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = s.keyPrefix + id
+	}
+	records, err := redis.ByteSlices(redis.DoContext(conn, ctx, "MGET", keys...))
+	if err != nil {
+		return nil, err
+	}
+	var list []*sessions.Session
+	stale := []interface{}{key}
+	for i, b := range records {
+		session := sessions.NewSession(s, "")
+		session.ID = ids[i]
+		if b != nil && s.serializer.Deserialize(b, session) == nil {
+			if id, ok := hs.BoundUser(session); ok && id == userID {
+				list = append(list, session)
+				continue
+			}
+		}
+		stale = append(stale, ids[i])
+	}
+	if _, err = redis.DoContext(conn, ctx, "ZREMRANGEBYSCORE", key, "-inf", now); err != nil {
+		return nil, err
+	}
+	if len(stale) > 1 {
+		if _, err = redis.DoContext(conn, ctx, "ZREM", stale...); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
@@ -54,6 +54,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	hs "github.com/hertz-contrib/sessions"
@@ -62,6 +63,16 @@ import (
 
 var sessionExpire = 86400 * 30
 
+// touchScript extends the TTL of KEYS[1] to ARGV[1] milliseconds once at
+// least ARGV[2] milliseconds have passed since it was last set.
+var touchScript = redis.NewScript(`
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 and tonumber(ARGV[1]) - ttl >= tonumber(ARGV[2]) then
+		return redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	end
+	return 0
+`)
+
 type Store struct {
 	Rdb           *redis.ClusterClient
 	Codecs        []securecookie.Codec
@@ -70,10 +81,20 @@ type Store struct {
 	maxLength     int
 	keyPrefix     string
 	serializer    hs.Serializer
+	transport     hs.Transport
+	userLimit     int
+	limitPolicy   hs.LimitPolicy
+	timeout       time.Duration
+	maxLifetime   int
+
+	rolling         bool
+	rollingInterval time.Duration
+	rollingCookie   bool
 }
 
 func (s *Store) Options(options hs.Options) {
 	s.Opts = options.ToGorillaOptions()
+	s.maxLifetime = options.MaxLifetime
 }
 
 // NewStoreWithOption returns a new rediscluster.Store by setting *redis.ClusterOptions
@@ -89,6 +110,7 @@ func NewStoreWithOption(opt *redis.ClusterOptions, kvs ...[]byte) (*Store, error
 		maxLength:     4096,
 		keyPrefix:     "session_",
 		serializer:    hs.GobSerializer{},
+		transport:     hs.CookieTransport{},
 	}
 	err := rs.Rdb.ForEachShard(context.Background(), func(ctx context.Context, shard *redis.Client) error {
 		return shard.Ping(ctx).Err()
@@ -106,6 +128,17 @@ func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
 }
 
 func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	return s.newSession(r.Context(), hs.HTTPCarrier(r, nil), name)
+}
+
+// GetHertz returns a session for the given name, reading its ID from the
+// Hertz request.
+func (s *Store) GetHertz(ctx context.Context, c *app.RequestContext, name string) (*sessions.Session, error) {
+	return s.newSession(ctx, hs.HertzCarrier(c), name)
+}
+
+// newSession loads the session whose ID the transport reads.
+func (s *Store) newSession(ctx context.Context, carrier hs.Carrier, name string) (*sessions.Session, error) {
 	var (
 		err error
 		ok  bool
@@ -115,37 +148,119 @@ func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
 	options := *s.Opts
 	session.Options = &options
 	session.IsNew = true
-	if c, errCookie := r.Cookie(name); errCookie == nil {
-		err = securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
+	if value, found := s.transport.Token(carrier, name); found {
+		err = hs.DecodeCookie(ctx, name, value, &session.ID, s.Codecs...)
 		if err == nil {
-			ok, err = s.load(session)
+			ok, err = s.load(ctx, session)
 			session.IsNew = !(err == nil && ok) // not new if no error and data available
 		}
 	}
+	if err == nil && hs.LifetimeExceeded(session, s.maxLifetime) {
+		// The session outlived its absolute lifetime, start over.
+		if err = s.delete(ctx, session); err != nil {
+			return session, err
+		}
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+	}
+	if s.maxLifetime > 0 {
+		hs.StampCreated(session)
+	}
 	return session, err
 }
 
 func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	return s.saveSession(r.Context(), hs.HTTPCarrier(r, w), session)
+}
+
+// SaveHertz saves the session and sends its ID on the Hertz response.
+func (s *Store) SaveHertz(ctx context.Context, c *app.RequestContext, session *sessions.Session) error {
+	return s.saveSession(ctx, hs.HertzCarrier(c), session)
+}
+
+// saveSession stores the session and sends its ID with the transport.
+func (s *Store) saveSession(ctx context.Context, carrier hs.Carrier, session *sessions.Session) error {
 	// Marked for deletion.
 	if session.Options.MaxAge <= 0 {
-		if err := s.delete(session); err != nil {
+		if err := s.delete(ctx, session); err != nil {
 			return err
 		}
-		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		s.transport.SetToken(carrier, session.Name(), "", session.Options)
 	} else {
 		// Build an alphanumeric key for the redis store.
 		if session.ID == "" {
 			session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
 		}
-		if err := s.save(session); err != nil {
+		if err := s.save(ctx, session); err != nil {
 			return err
 		}
 		encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
 		if err != nil {
 			return err
 		}
-		http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+		s.transport.SetToken(carrier, session.Name(), encoded, session.Options)
+	}
+	return nil
+}
+
+// Touch refreshes the TTL of a session that was read but not modified
+// when sliding expiration is enabled. See SetRolling.
+func (s *Store) Touch(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	return s.touchSession(r.Context(), hs.HTTPCarrier(r, w), session)
+}
+
+// TouchHertz is Touch for the Hertz response.
+func (s *Store) TouchHertz(ctx context.Context, c *app.RequestContext, session *sessions.Session) error {
+	return s.touchSession(ctx, hs.HertzCarrier(c), session)
+}
+
+// touchSession refreshes the TTL of the session, and its ID if enabled.
+func (s *Store) touchSession(ctx context.Context, carrier hs.Carrier, session *sessions.Session) error {
+	if !s.rolling || session.IsNew || session.ID == "" || session.Options.MaxAge < 0 {
+		return nil
+	}
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	if !hs.TouchDue(session, time.Duration(age)*time.Second, s.rollingInterval) {
+		return nil
+	}
+	touched, err := s.touch(ctx, session, time.Duration(age)*time.Second)
+	if err != nil || !touched {
+		return err
+	}
+	hs.StampTTL(session, time.Duration(age)*time.Second)
+	if !s.rollingCookie {
+		return nil
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	s.transport.SetToken(carrier, session.Name(), encoded, session.Options)
+	return nil
+}
+
+// Regenerate removes the session from redis and clears its ID,
+// so that the next Save stores the values under a fresh ID.
+func (s *Store) Regenerate(r *http.Request, session *sessions.Session) error {
+	return s.regenerate(r.Context(), session)
+}
+
+// RegenerateHertz is Regenerate for the Hertz request.
+func (s *Store) RegenerateHertz(ctx context.Context, _ *app.RequestContext, session *sessions.Session) error {
+	return s.regenerate(ctx, session)
+}
+
+func (s *Store) regenerate(ctx context.Context, session *sessions.Session) error {
+	if session.ID != "" {
+		if err := s.delete(ctx, session); err != nil {
+			return err
+		}
 	}
+	session.ID = ""
 	return nil
 }
 
@@ -175,20 +290,108 @@ func (s *Store) SetSerializer(ss hs.Serializer) {
 	s.serializer = ss
 }
 
-func (s *Store) load(session *sessions.Session) (bool, error) {
-	res := s.Rdb.Get(context.Background(), s.keyPrefix+session.ID)
-	if res == nil {
-		return false, nil
+// SetTransport sets how the session ID travels between the client and the
+// store, in the session cookie by default. See sessions.Transport.
+func (s *Store) SetTransport(t hs.Transport) {
+	s.transport = t
+}
+
+// SetUserLimit caps the number of sessions bound to a user, see
+// sessions.UserIDKey, to max. Saving one more session then either fails or
+// deletes the oldest sessions of the user, according to policy. The limit
+// is enforced atomically in redis, so concurrent logins can't exceed it.
+// Set max to 0 for no limit, the default.
+func (s *Store) SetUserLimit(max int, policy hs.LimitPolicy) {
+	s.userLimit = max
+	s.limitPolicy = policy
+}
+
+// SetMaxLifetime caps the lifetime, in seconds, of the sessions of the store
+// counted from their creation regardless of activity. Older sessions are
+// deleted and treated as new. Set it to 0 for no restriction.
+func (s *Store) SetMaxLifetime(v int) {
+	s.maxLifetime = v
+}
+
+// SetTimeout sets the timeout of every redis operation issued by the store.
+// Operations are also canceled together with the request they serve.
+// Default: 0, no timeout.
+func (s *Store) SetTimeout(d time.Duration) {
+	s.timeout = d
+}
+
+// SetRolling enables sliding expiration. A session that was read but not
+// modified then has its TTL refreshed when the handler returns or saves it,
+// at most once per minInterval, so that active users are not logged out
+// after the session age.
+// The TTL is read along with the session, so that touching it within
+// minInterval costs no round trip.
+// With refreshCookie the cookie is sent again so its Max-Age slides too.
+func (s *Store) SetRolling(minInterval time.Duration, refreshCookie bool) {
+	s.rolling = true
+	s.rollingInterval = minInterval
+	s.rollingCookie = refreshCookie
+}
+
+// withTimeout bounds ctx by the operation timeout of the store, if any.
+func (s *Store) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(ctx, s.timeout)
+	}
+	return ctx, func() {}
+}
+
+func (s *Store) load(ctx context.Context, session *sessions.Session) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if !s.rolling {
+		b, err := s.Rdb.Get(ctx, s.keyPrefix+session.ID).Bytes()
+		if err == redis.Nil {
+			return false, nil // no data was associated with this key
+		}
+		if err != nil {
+			return false, hs.Unavailable(err)
+		}
+		return true, s.serializer.Deserialize(b, session)
+	}
+	// read the TTL along, to touch the session only once it is due
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := s.Rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		get = p.Get(ctx, s.keyPrefix+session.ID)
+		pttl = p.PTTL(ctx, s.keyPrefix+session.ID)
+		return nil
+	})
+	if err == redis.Nil {
+		return false, nil // no data was associated with this key
 	}
-	b, err := res.Bytes()
 	if err != nil {
+		return false, hs.Unavailable(err)
+	}
+	b, _ := get.Bytes()
+	if err = s.serializer.Deserialize(b, session); err != nil {
+		return true, err
+	}
+	hs.StampTTL(session, pttl.Val())
+	return true, nil
+}
+
+// touch extends the TTL of the session to age, unless it was already
+// refreshed within the rolling interval. Returns true if the TTL was extended.
+func (s *Store) touch(ctx context.Context, session *sessions.Session, age time.Duration) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	n, err := touchScript.Run(ctx, s.Rdb, []string{s.keyPrefix + session.ID}, age.Milliseconds(), s.rollingInterval.Milliseconds()).Int()
+	if err != nil || n != 1 {
 		return false, err
 	}
-	return true, s.serializer.Deserialize(b, session)
+	_, err = s.index(ctx, session, age, 0)
+	return true, err
 }
 
 // save stores the session in redis.
-func (s *Store) save(session *sessions.Session) error {
+func (s *Store) save(ctx context.Context, session *sessions.Session) error {
+	hs.UnstampTTL(session)
 	b, err := s.serializer.Serialize(session)
 	if err != nil {
 		return err
@@ -200,8 +403,17 @@ func (s *Store) save(session *sessions.Session) error {
 	if age == 0 {
 		age = s.DefaultMaxAge
 	}
-	err = s.Rdb.SetEx(context.Background(), s.keyPrefix+session.ID, b, time.Duration(age)*time.Second).Err()
-	return err
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	// admit the session in the index of its user first, which may be full
+	evicted, err := s.index(ctx, session, time.Duration(age)*time.Second, s.userLimit)
+	if err != nil {
+		return err
+	}
+	if err = s.Rdb.SetEx(ctx, s.keyPrefix+session.ID, b, time.Duration(age)*time.Second).Err(); err != nil {
+		return err
+	}
+	return s.evict(ctx, evicted)
 }
 
 func (s *Store) ping() (bool, error) {
@@ -212,16 +424,20 @@ func (s *Store) ping() (bool, error) {
 	return true, nil
 }
 
-func (s *Store) delete(session *sessions.Session) error {
-	del := s.Rdb.Del(context.Background(), s.keyPrefix+session.ID)
-	return del.Err()
+func (s *Store) delete(ctx context.Context, session *sessions.Session) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if err := s.Rdb.Del(ctx, s.keyPrefix+session.ID).Err(); err != nil {
+		return err
+	}
+	return s.unindex(ctx, session)
 }
 
 // LoadSessionBySessionId Get session using session_id even without a context
 func LoadSessionBySessionId(s *Store, sessionId string) (*sessions.Session, error) {
 	var session sessions.Session
 	session.ID = sessionId
-	exist, err := s.load(&session)
+	exist, err := s.load(context.Background(), &session)
 	if err != nil {
 		return nil, err
 	}
@@ -234,7 +450,7 @@ func LoadSessionBySessionId(s *Store, sessionId string) (*sessions.Session, erro
 // SaveSessionWithoutContext Save session even without a context
 func SaveSessionWithoutContext(s *Store, sessionId string, session *sessions.Session) error {
 	session.ID = sessionId
-	return s.save(session)
+	return s.save(context.Background(), session)
 }
 
 func newOption(
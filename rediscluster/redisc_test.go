@@ -48,14 +48,22 @@ package rediscluster
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/gob"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
+	hs "github.com/hertz-contrib/sessions"
 )
 
 func init() {
@@ -373,3 +381,264 @@ func TestPingGoodPort(t *testing.T) {
 		t.Error("Expected server to PONG")
 	}
 }
+
+func TestRequestContext(t *testing.T) {
+	store, err := NewStore(10, []string{"localhost:5000", "localhost:5001"}, "", nil, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://localhost:8080/", nil)
+	session := sessions.NewSession(store, "session-key")
+	session.Options = &sessions.Options{MaxAge: 60}
+	if err = store.Save(req, NewRecorder(), session); err == nil {
+		t.Fatal("Expected an error saving with a canceled request context")
+	}
+
+	store.SetTimeout(time.Nanosecond)
+	req, _ = http.NewRequest("GET", "http://localhost:8080/", nil)
+	if err = store.Save(req, NewRecorder(), session); err == nil {
+		t.Fatal("Expected an error saving past the operation timeout")
+	}
+}
+
+func TestRolling(t *testing.T) {
+	store, err := NewStore(10, []string{"localhost:5000", "localhost:5001"}, "", nil, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+	ctx := context.Background()
+	age := time.Duration(store.Opts.MaxAge) * time.Second
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session := sessions.NewSession(store, "session-key")
+	session.Options = &sessions.Options{MaxAge: store.Opts.MaxAge}
+	session.Values["key"] = "val"
+	if err = store.Save(req, NewRecorder(), session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	key := "session_" + session.ID
+
+	store.SetRolling(time.Minute, false)
+	store.Rdb.Expire(ctx, key, age-30*time.Second)
+	if err = store.Touch(req, NewRecorder(), session); err != nil {
+		t.Fatalf("Error touching session: %v", err)
+	}
+	if ttl := store.Rdb.TTL(ctx, key).Val(); ttl > age-30*time.Second {
+		t.Fatalf("Expected the TTL to be kept within the rolling interval, got %v", ttl)
+	}
+
+	// A loaded session is only touched once due according to the TTL read
+	// along with it: shortening the TTL afterwards goes unnoticed.
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, store.Codecs...)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	loadReq, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	loadReq.Header.Add("Cookie", "session-key="+encoded)
+	loaded, err := store.New(loadReq, "session-key")
+	if err != nil || loaded.IsNew {
+		t.Fatalf("Expected the session to be loaded, got %v", err)
+	}
+	store.Rdb.Expire(ctx, key, 10*time.Second)
+	if err = store.Touch(loadReq, NewRecorder(), loaded); err != nil {
+		t.Fatalf("Error touching session: %v", err)
+	}
+	if ttl := store.Rdb.TTL(ctx, key).Val(); ttl > 10*time.Second {
+		t.Fatalf("Expected no touch within the rolling interval, got %v", ttl)
+	}
+
+	store.SetRolling(0, true)
+	store.Rdb.Expire(ctx, key, 10*time.Second)
+	rsp := NewRecorder()
+	if err = store.Touch(req, rsp, session); err != nil {
+		t.Fatalf("Error touching session: %v", err)
+	}
+	if ttl := store.Rdb.TTL(ctx, key).Val(); ttl < age-time.Second {
+		t.Fatalf("Expected the TTL to be refreshed, got %v", ttl)
+	}
+	if len(rsp.Header()["Set-Cookie"]) != 1 {
+		t.Fatal("Expected the cookie to be sent again")
+	}
+}
+
+func TestHertzStore(t *testing.T) {
+	store, err := NewStore(10, []string{"localhost:5000", "localhost:5001"}, "", nil, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	c := app.NewContext(0)
+	session, err := store.GetHertz(ctx, c, "hertz-session")
+	if err != nil || !session.IsNew {
+		t.Fatalf("Expected a new session, got %v", err)
+	}
+	session.Values["key"] = "value"
+	if err = store.SaveHertz(ctx, c, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	cookie := c.Response.Header.FullCookie()
+	if len(cookie) == 0 {
+		t.Fatal("No cookie set on the Hertz response")
+	}
+
+	c = app.NewContext(0)
+	c.Request.Header.Set("Cookie", string(bytes.SplitN(cookie, []byte(";"), 2)[0]))
+	session, err = store.GetHertz(ctx, c, "hertz-session")
+	if err != nil || session.IsNew || session.Values["key"] != "value" {
+		t.Fatalf("Expected the saved session, got %v, %v", session.Values, err)
+	}
+
+	session.Options.MaxAge = -1
+	if err = store.SaveHertz(ctx, c, session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	session, err = store.GetHertz(ctx, c, "hertz-session")
+	if err != nil || !session.IsNew {
+		t.Fatalf("Expected the deleted session to be new, got %v", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	store, err := NewStore(10, []string{"localhost:5000", "localhost:5001"}, "", nil, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+	store.SetTransport(hs.HeaderTransport{Header: "X-Session-Token"})
+	ctx := context.Background()
+
+	c := app.NewContext(0)
+	session, err := store.GetHertz(ctx, c, "hertz-session")
+	if err != nil {
+		t.Fatalf("Error getting session: %v", err)
+	}
+	session.Values["key"] = "value"
+	if err = store.SaveHertz(ctx, c, session); err != nil {
+		t.Fatalf("Error saving session: %v", err)
+	}
+	token := string(c.Response.Header.Peek("X-Session-Token"))
+	if token == "" || len(c.Response.Header.FullCookie()) != 0 {
+		t.Fatalf("Expected the token in a header only, got %q", c.Response.Header.Header())
+	}
+
+	// the token is read the same way through net/http
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	req.Header.Set("X-Session-Token", token)
+	session, err = store.New(req, "hertz-session")
+	if err != nil || session.IsNew || session.Values["key"] != "value" {
+		t.Fatalf("Expected the saved session, got %v, %v", session.Values, err)
+	}
+
+	session.Options.MaxAge = -1
+	rsp := NewRecorder()
+	if err = store.Save(req, rsp, session); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	if v, ok := rsp.Header()["X-Session-Token"]; !ok || v[0] != "" {
+		t.Fatalf("Expected an empty token, got %q", v)
+	}
+}
+
+func TestUserSessions(t *testing.T) {
+	store, err := NewStore(10, []string{"localhost:5000", "localhost:5001"}, "", nil, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+	ctx := context.Background()
+	userID := base64.StdEncoding.EncodeToString([]byte(time.Now().String()))
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	var saved []*sessions.Session
+	for i := 0; i < 3; i++ {
+		session := sessions.NewSession(store, "session-key")
+		session.Options = &sessions.Options{MaxAge: 60}
+		session.Values[hs.UserIDKey] = userID
+		if err = store.Save(req, NewRecorder(), session); err != nil {
+			t.Fatalf("Error saving session: %v", err)
+		}
+		saved = append(saved, session)
+	}
+
+	saved[0].Options.MaxAge = -1
+	if err = store.Save(req, NewRecorder(), saved[0]); err != nil {
+		t.Fatalf("Error deleting session: %v", err)
+	}
+	list, err := store.ListUserSessions(ctx, userID)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d, %v", len(list), err)
+	}
+	if n, _ := store.Rdb.ZCard(ctx, store.userKey(userID)).Result(); n != 2 {
+		t.Fatalf("Expected the deleted session to leave the index, got %d", n)
+	}
+
+	n, err := store.RevokeUserSessions(ctx, userID)
+	if err != nil || n != 2 {
+		t.Fatalf("Expected 2 revoked sessions, got %d, %v", n, err)
+	}
+	for _, session := range saved[1:] {
+		if loaded, _ := LoadSessionBySessionId(store, session.ID); loaded != nil {
+			t.Fatal("Expected the revoked session to be deleted")
+		}
+	}
+	if list, _ = store.ListUserSessions(ctx, userID); len(list) != 0 {
+		t.Fatalf("Expected no session left, got %d", len(list))
+	}
+}
+
+func TestUserLimit(t *testing.T) {
+	store, err := NewStore(10, []string{"localhost:5000", "localhost:5001"}, "", nil, []byte("secret-key"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer store.Close()
+	userID := base64.StdEncoding.EncodeToString([]byte(time.Now().String()))
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	save := func(maxAge int) (*sessions.Session, error) {
+		session := sessions.NewSession(store, "session-key")
+		session.Options = &sessions.Options{MaxAge: maxAge}
+		session.Values[hs.UserIDKey] = userID
+		return session, store.Save(req, NewRecorder(), session)
+	}
+
+	// concurrent logins can't exceed the limit
+	store.SetUserLimit(2, hs.RejectNewSession)
+	var wg sync.WaitGroup
+	var saved int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := save(60); err == nil {
+				atomic.AddInt32(&saved, 1)
+			} else if !errors.Is(err, hs.ErrSessionLimit) {
+				t.Errorf("Expected ErrSessionLimit, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if saved != 2 {
+		t.Fatalf("Expected 2 concurrent sessions to be saved, got %d", saved)
+	}
+
+	store.SetUserLimit(2, hs.EvictOldestSession)
+	kept, err := save(3600)
+	if err != nil {
+		t.Fatalf("Expected the oldest session to be evicted, got %v", err)
+	}
+	list, err := store.ListUserSessions(context.Background(), userID)
+	if err != nil || len(list) != 2 || (list[0].ID != kept.ID && list[1].ID != kept.ID) {
+		t.Fatalf("Expected 2 sessions with the new one, got %v, %v", list, err)
+	}
+	if _, err = store.RevokeUserSessions(context.Background(), userID); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package rediscluster
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+	hs "github.com/hertz-contrib/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// indexScript adds the session ARGV[1], expiring at ARGV[2], to the user
+// index KEYS[1], a sorted set scored by expiration time in Unix milliseconds.
+// It drops the sessions expired at ARGV[3], and keeps the index as long as
+// its last session.
+//
+// A session not indexed yet is only added while the index holds less than
+// ARGV[4] sessions, unless ARGV[4] is 0: otherwise the script returns nil,
+// or evicts the sessions expiring first if ARGV[5] is 1. It returns the IDs
+// of the evicted sessions, whose records are left to the caller.
+var indexScript = redis.NewScript(`
+	redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[3])
+	local evicted = {}
+	local limit = tonumber(ARGV[4])
+	if limit > 0 and not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+		local n = redis.call('ZCARD', KEYS[1])
+		if n >= limit then
+			if ARGV[5] ~= '1' then
+				return false
+			end
+			evicted = redis.call('ZRANGE', KEYS[1], 0, n - limit)
+			redis.call('ZREMRANGEBYRANK', KEYS[1], 0, n - limit)
+		end
+	end
+	redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+	local last = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+	redis.call('PEXPIREAT', KEYS[1], last[2])
+	return evicted
+`)
+
+// unixMilli returns t in Unix milliseconds, as time.Time.UnixMilli which
+// needs Go 1.17.
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// userKey returns the key of the index of the sessions of a user.
+func (s *Store) userKey(userID string) string {
+	return s.keyPrefix + "user_" + userID
+}
+
+// index records the session in the index of its user, if it is bound to one,
+// and returns the IDs of the sessions evicted to keep the user under limit.
+// It fails with ErrSessionLimit if the session is rejected instead.
+func (s *Store) index(ctx context.Context, session *sessions.Session, age time.Duration, limit int) ([]string, error) {
+	userID, ok := hs.BoundUser(session)
+	if !ok {
+		return nil, nil
+	}
+	evicted, err := s.runIndex(ctx, userID, session, age, limit)
+	if err == redis.Nil {
+		// the index may hold sessions deleted or bound to another user
+		// meanwhile, which don't count: prune them and try again
+		if _, err = s.userSessions(ctx, userID); err != nil {
+			return nil, err
+		}
+		evicted, err = s.runIndex(ctx, userID, session, age, limit)
+	}
+	if err == redis.Nil {
+		return nil, hs.ErrSessionLimit
+	}
+	return evicted, err
+}
+
+func (s *Store) runIndex(ctx context.Context, userID string, session *sessions.Session, age time.Duration, limit int) ([]string, error) {
+	evict := 0
+	if s.limitPolicy == hs.EvictOldestSession {
+		evict = 1
+	}
+	now := time.Now()
+	return indexScript.Run(ctx, s.Rdb, []string{s.userKey(userID)}, session.ID,
+		unixMilli(now.Add(age)), unixMilli(now), limit, evict).StringSlice()
+}
+
+// evict deletes the records of the sessions evicted from a user index.
+func (s *Store) evict(ctx context.Context, ids []string) error {
+	// the sessions are in different slots, delete them one by one
+	pipe := s.Rdb.Pipeline()
+	for _, id := range ids {
+		pipe.Del(ctx, s.keyPrefix+id)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// unindex removes the session from the index of its user.
+func (s *Store) unindex(ctx context.Context, session *sessions.Session) error {
+	userID, ok := hs.BoundUser(session)
+	if !ok {
+		return nil
+	}
+	return s.Rdb.ZRem(ctx, s.userKey(userID), session.ID).Err()
+}
+
+// ListUserSessions returns the live sessions bound to the user with
+// sessions.UserIDKey, e.g. to show the devices of the user. Like
+// LoadSessionBySessionId it doesn't need a request.
+func (s *Store) ListUserSessions(ctx context.Context, userID string) ([]*sessions.Session, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	return s.userSessions(ctx, userID)
+}
+
+// RevokeUserSessions deletes all the sessions bound to the user, e.g. after a
+// password change, and returns how many were deleted.
+func (s *Store) RevokeUserSessions(ctx context.Context, userID string) (int, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	list, err := s.userSessions(ctx, userID)
+	if err != nil || len(list) == 0 {
+		return 0, err
+	}
+	members := make([]interface{}, len(list))
+	// the sessions are in different slots, delete them one by one
+	pipe := s.Rdb.Pipeline()
+	for i, session := range list {
+		pipe.Del(ctx, s.keyPrefix+session.ID)
+		members[i] = session.ID
+	}
+	pipe.ZRem(ctx, s.userKey(userID), members...)
+	if _, err = pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return len(list), nil
+}
+
+// userSessions loads the sessions of the index of the user, and prunes the
+// index of the sessions which expired, were deleted or were bound to another
+// user since they were indexed.
+func (s *Store) userSessions(ctx context.Context, userID string) ([]*sessions.Session, error) {
+	key := s.userKey(userID)
+	now := strconv.FormatInt(unixMilli(time.Now()), 10)
+	ids, err := s.Rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: now, Max: "+inf"}).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	pipe := s.Rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.Get(ctx, s.keyPrefix+id)
+	}
+	if _, err = pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	var list []*sessions.Session
+	var stale []interface{}
+	for i, cmd := range cmds {
+		session := sessions.NewSession(s, "")
+		session.ID = ids[i]
+		if b, err := cmd.Bytes(); err == nil && s.serializer.Deserialize(b, session) == nil {
+			if id, ok := hs.BoundUser(session); ok && id == userID {
+				list = append(list, session)
+				continue
+			}
+		}
+		stale = append(stale, ids[i])
+	}
+	if err = s.Rdb.ZRemRangeByScore(ctx, key, "-inf", now).Err(); err != nil {
+		return nil, err
+	}
+	if len(stale) > 0 {
+		if err = s.Rdb.ZRem(ctx, key, stale...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
@@ -48,12 +48,15 @@ package sessions
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
+	"io"
 
 	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/gorilla/sessions"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 // Serializer provides an interface hook for alternative serializers
@@ -113,3 +116,180 @@ func (s GobSerializer) Deserialize(d []byte, ss *sessions.Session) error {
 	dec := gob.NewDecoder(bytes.NewBuffer(d))
 	return dec.Decode(&ss.Values)
 }
+
+// MsgPackSerializer encode the session map to MessagePack, which keeps
+// integers, floats, byte slices and times apart, accepts non-string keys and
+// can be read by services written in other languages.
+// Integer keys are decoded as int, or int64 and uint64 if they overflow it,
+// integer values as int64 or uint64, in nested slices and maps too.
+type MsgPackSerializer struct{}
+
+// Serialize to MessagePack
+func (s MsgPackSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	return msgpack.Marshal(ss.Values)
+}
+
+// Deserialize back to map[interface{}]interface{}
+func (s MsgPackSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(d))
+	dec.SetMapDecoder(decodeMsgpackMap)
+	m, err := dec.DecodeUntypedMap()
+	if err != nil {
+		hlog.Errorf("redistore.MsgPackSerializer.deserialize() Error: %v", err)
+		return err
+	}
+	for k, v := range m {
+		ss.Values[msgpackKey(k)] = msgpackInt(v)
+	}
+	return nil
+}
+
+// decodeMsgpackMap decodes the nested maps as map[string]interface{}, or as
+// map[interface{}]interface{} when they have keys other than strings.
+func decodeMsgpackMap(d *msgpack.Decoder) (interface{}, error) {
+	m, err := d.DecodeUntypedMap()
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return map[string]interface{}(nil), nil
+	}
+	sm := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		s, ok := k.(string)
+		if !ok {
+			return m, nil
+		}
+		sm[s] = v
+	}
+	return sm, nil
+}
+
+// msgpackKey gives integer keys back the usual int type, as MessagePack
+// doesn't tell integer types apart. Keys overflowing an int are widened only.
+func msgpackKey(k interface{}) interface{} {
+	switch n := msgpackInt(k).(type) {
+	case int64:
+		if i := int(n); int64(i) == n {
+			return i
+		}
+		return n
+	case uint64:
+		if i := int(n); i >= 0 && uint64(i) == n {
+			return i
+		}
+		return n
+	}
+	return k
+}
+
+// msgpackInt widens the integers decoded by msgpack to int64 and uint64,
+// whatever the size they were encoded with.
+func msgpackInt(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case uint8:
+		return uint64(n)
+	case uint16:
+		return uint64(n)
+	case uint32:
+		return uint64(n)
+	case []interface{}:
+		for i := range n {
+			n[i] = msgpackInt(n[i])
+		}
+	case map[string]interface{}:
+		for k := range n {
+			n[k] = msgpackInt(n[k])
+		}
+	case map[interface{}]interface{}:
+		m := make(map[interface{}]interface{}, len(n))
+		for k, e := range n {
+			m[msgpackKey(k)] = msgpackInt(e)
+		}
+		return m
+	}
+	return v
+}
+
+// gzipMagic prefixes the records compressed by GzipSerializer. Encoded session
+// values never start with a zero byte, so records written before compression
+// was enabled are still told apart.
+var gzipMagic = []byte("\x00hsgz")
+
+// GzipSerializer wraps another Serializer and gzips its output, so that
+// large sessions fit into the maximum length of the stores, which is checked
+// against the compressed bytes.
+// Records without the magic header are handed to the inner Serializer as is,
+// which keeps the records written before compression was enabled readable.
+type GzipSerializer struct {
+	// Serializer encodes the session values, GobSerializer when nil.
+	Serializer Serializer
+	// Threshold is the length from which the output is compressed,
+	// smaller outputs are stored uncompressed. Zero compresses everything.
+	Threshold int
+	// Level is the gzip compression level, zero means gzip.DefaultCompression.
+	// Use GzipNoCompression for gzip.NoCompression.
+	Level int
+}
+
+// GzipNoCompression is the GzipSerializer.Level storing the records in gzip
+// format without compressing them, as gzip.NoCompression is zero and thus
+// stands for the default level.
+const GzipNoCompression = -3
+
+func (s GzipSerializer) inner() Serializer {
+	if s.Serializer == nil {
+		return GobSerializer{}
+	}
+	return s.Serializer
+}
+
+// Serialize with the inner Serializer, then gzip when over the threshold
+func (s GzipSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	b, err := s.inner().Serialize(ss)
+	if err != nil || len(b) < s.Threshold {
+		return b, err
+	}
+	level := s.Level
+	switch level {
+	case 0:
+		level = gzip.DefaultCompression
+	case GzipNoCompression:
+		level = gzip.NoCompression
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(b)/2))
+	buf.Write(gzipMagic)
+	zw, err := gzip.NewWriterLevel(buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = zw.Write(b); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Deserialize gunzips compressed records, then decodes them with the inner Serializer
+func (s GzipSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	if bytes.HasPrefix(d, gzipMagic) {
+		zr, err := gzip.NewReader(bytes.NewReader(d[len(gzipMagic):]))
+		if err != nil {
+			hlog.Errorf("redistore.GzipSerializer.deserialize() Error: %v", err)
+			return err
+		}
+		if d, err = io.ReadAll(zr); err != nil {
+			hlog.Errorf("redistore.GzipSerializer.deserialize() Error: %v", err)
+			return err
+		}
+	}
+	return s.inner().Deserialize(d, ss)
+}
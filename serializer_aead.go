@@ -0,0 +1,171 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sessions
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/gorilla/sessions"
+)
+
+// ErrDecrypt is matched by the errors of AEADSerializer when a record can't
+// be decrypted: it is not encrypted, was encrypted with an unknown key or was
+// tampered with.
+var ErrDecrypt = errors.New("sessions: cannot decrypt session payload")
+
+// aeadMagic prefixes the records encrypted by AEADSerializer.
+var aeadMagic = []byte("\x00hsae")
+
+// AEADKey is an AES key used by AEADSerializer, with the ID written in
+// front of the records it encrypts.
+type AEADKey struct {
+	// ID names the key in the records, at most 255 bytes long.
+	ID string
+	// Key is the AES key, 16, 24 or 32 bytes long to select
+	// AES-128, AES-192 or AES-256.
+	Key []byte
+}
+
+type aeadKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// AEADSerializer wraps another Serializer and encrypts its output with
+// AES-GCM, so that the session values are not readable by anyone with access
+// to the backend. The session ID is authenticated along with the payload, so a
+// record copied under another ID doesn't decrypt.
+//
+// The first key encrypts, all keys decrypt: to rotate keys, put the new one
+// first and drop the old one once the sessions it encrypted have expired.
+// Records that are not encrypted are rejected.
+//
+// To compress the payloads as well, wrap a GzipSerializer: encrypted data
+// doesn't compress.
+type AEADSerializer struct {
+	serializer Serializer
+	keys       []aeadKey
+}
+
+// NewAEADSerializer returns an AEADSerializer encrypting the output of s,
+// GobSerializer when nil, with the given keys.
+func NewAEADSerializer(s Serializer, keys ...AEADKey) (*AEADSerializer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("sessions: no AEAD key")
+	}
+	if s == nil {
+		s = GobSerializer{}
+	}
+	as := &AEADSerializer{serializer: s, keys: make([]aeadKey, 0, len(keys))}
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k.ID == "" || len(k.ID) > 255 {
+			return nil, fmt.Errorf("sessions: invalid AEAD key ID %q", k.ID)
+		}
+		if seen[k.ID] {
+			return nil, fmt.Errorf("sessions: duplicate AEAD key ID %q", k.ID)
+		}
+		seen[k.ID] = true
+		block, err := aes.NewCipher(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("sessions: AEAD key %q: %w", k.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		as.keys = append(as.keys, aeadKey{id: k.ID, aead: aead})
+	}
+	return as, nil
+}
+
+// header returns the magic header followed by the key ID.
+func (s *AEADSerializer) header(id string) []byte {
+	h := make([]byte, 0, len(aeadMagic)+1+len(id))
+	h = append(h, aeadMagic...)
+	h = append(h, byte(len(id)))
+	return append(h, id...)
+}
+
+// additionalData authenticates the header and the session ID.
+func (s *AEADSerializer) additionalData(header []byte, ss *sessions.Session) []byte {
+	ad := make([]byte, 0, len(header)+len(ss.ID))
+	ad = append(ad, header...)
+	return append(ad, ss.ID...)
+}
+
+// Serialize with the inner Serializer, then encrypt with the first key
+func (s *AEADSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	b, err := s.serializer.Serialize(ss)
+	if err != nil {
+		return nil, err
+	}
+	k := s.keys[0]
+	header := s.header(k.id)
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(header)+len(nonce)+len(b)+k.aead.Overhead())
+	out = append(out, header...)
+	out = append(out, nonce...)
+	return k.aead.Seal(out, nonce, b, s.additionalData(header, ss)), nil
+}
+
+// Deserialize decrypts with the key named in the record, then decodes with the inner Serializer
+func (s *AEADSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	b, err := s.open(d, ss)
+	if err != nil {
+		hlog.Errorf("redistore.AEADSerializer.deserialize() Error: %v", err)
+		return err
+	}
+	return s.serializer.Deserialize(b, ss)
+}
+
+func (s *AEADSerializer) open(d []byte, ss *sessions.Session) ([]byte, error) {
+	if !bytes.HasPrefix(d, aeadMagic) || len(d) == len(aeadMagic) {
+		return nil, fmt.Errorf("%w: not encrypted", ErrDecrypt)
+	}
+	n := int(d[len(aeadMagic)])
+	if len(d) < len(aeadMagic)+1+n {
+		return nil, fmt.Errorf("%w: truncated record", ErrDecrypt)
+	}
+	header := d[:len(aeadMagic)+1+n]
+	id := string(header[len(aeadMagic)+1:])
+	for _, k := range s.keys {
+		if k.id != id {
+			continue
+		}
+		rest := d[len(header):]
+		if len(rest) < k.aead.NonceSize() {
+			return nil, fmt.Errorf("%w: truncated record", ErrDecrypt)
+		}
+		nonce, ciphertext := rest[:k.aead.NonceSize()], rest[k.aead.NonceSize():]
+		b, err := k.aead.Open(nil, nonce, ciphertext, s.additionalData(header, ss))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", ErrDecrypt, id)
+}
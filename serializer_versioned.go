@@ -0,0 +1,133 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sessions
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/gorilla/sessions"
+)
+
+// versionMagic prefixes the records written by VersionedSerializer, followed
+// by the version as an uvarint.
+var versionMagic = []byte("\x00hsv")
+
+// Migration upgrades session values decoded from a record of version N to
+// the shape expected at version N+1.
+type Migration func(values map[interface{}]interface{}) error
+
+type versionStep struct {
+	serializer Serializer
+	migration  Migration
+}
+
+// VersionedSerializer stamps the schema version on every record, and
+// upgrades the records of older versions when reading them.
+//
+// Each older version is registered with the Serializer its records were
+// written with and the Migration to the next version, so the records are
+// migrated lazily, one version after the other, and are written back in the
+// current version and format the next time the session is saved.
+// Records written without VersionedSerializer are version 0: registering
+// version 0 with GobSerializer reads the records of the default serializer.
+type VersionedSerializer struct {
+	version    uint64
+	serializer Serializer
+	steps      map[uint64]versionStep
+}
+
+// NewVersionedSerializer returns a VersionedSerializer writing records of the
+// given version with s.
+func NewVersionedSerializer(version uint64, s Serializer) *VersionedSerializer {
+	return &VersionedSerializer{
+		version:    version,
+		serializer: s,
+		steps:      make(map[uint64]versionStep),
+	}
+}
+
+// Register registers how to read the records of an older version: they are
+// decoded with s, then upgraded to version+1 by m. A nil m leaves the values
+// as is, to only change the serializer, and a nil s reads the records with
+// the current serializer, to only migrate the values.
+// Register must be called before the serializer is used.
+func (s *VersionedSerializer) Register(version uint64, ss Serializer, m Migration) *VersionedSerializer {
+	s.steps[version] = versionStep{serializer: ss, migration: m}
+	return s
+}
+
+// Serialize with the current serializer, stamped with the current version
+func (s *VersionedSerializer) Serialize(ss *sessions.Session) ([]byte, error) {
+	b, err := s.serializer.Serialize(ss)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(versionMagic)+binary.MaxVarintLen64+len(b))
+	out = append(out, versionMagic...)
+	var buf [binary.MaxVarintLen64]byte
+	out = append(out, buf[:binary.PutUvarint(buf[:], s.version)]...)
+	return append(out, b...), nil
+}
+
+// Deserialize with the serializer of the record version, then migrate to the current version
+func (s *VersionedSerializer) Deserialize(d []byte, ss *sessions.Session) error {
+	if err := s.deserialize(d, ss); err != nil {
+		hlog.Errorf("redistore.VersionedSerializer.deserialize() Error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (s *VersionedSerializer) deserialize(d []byte, ss *sessions.Session) error {
+	var version uint64
+	if bytes.HasPrefix(d, versionMagic) {
+		v, n := binary.Uvarint(d[len(versionMagic):])
+		if n <= 0 {
+			return fmt.Errorf("sessions: invalid record version")
+		}
+		version, d = v, d[len(versionMagic)+n:]
+	}
+	if version == s.version {
+		return s.serializer.Deserialize(d, ss)
+	}
+	if version > s.version {
+		return fmt.Errorf("sessions: record version %d is newer than %d", version, s.version)
+	}
+	for v := version; v < s.version; v++ {
+		if _, ok := s.steps[v]; !ok {
+			return fmt.Errorf("sessions: no migration from record version %d", v)
+		}
+	}
+	ds := s.steps[version].serializer
+	if ds == nil {
+		ds = s.serializer
+	}
+	if err := ds.Deserialize(d, ss); err != nil {
+		return err
+	}
+	for v := version; v < s.version; v++ {
+		if m := s.steps[v].migration; m != nil {
+			if err := m(ss.Values); err != nil {
+				return fmt.Errorf("sessions: migrate record version %d: %w", v, err)
+			}
+		}
+	}
+	return nil
+}
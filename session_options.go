@@ -42,10 +42,20 @@ package sessions
 
 import (
 	"net/http"
+	"time"
 
 	gsessions "github.com/gorilla/sessions"
 )
 
+// CreatedAtKey is the session value key under which stores record the Unix
+// time a session was created at, when Options.MaxLifetime is set.
+const CreatedAtKey = "_created_at"
+
+// UserIDKey is the session value key binding a session to a user: set it to
+// the ID of the user, as a string, once logged in. Stores supporting it index
+// the sessions of each user, see RediStore.ListUserSessions.
+const UserIDKey = "_user_id"
+
 // Options stores configuration for a session or session store.
 // Fields are a subset of http.Cookie fields.
 type Options struct {
@@ -61,6 +71,10 @@ type Options struct {
 	//   refer: https://godoc.org/net/http
 	//          https://www.sjoerdlangkemper.nl/2016/04/14/preventing-csrf-with-samesite-cookie-attribute/
 	SameSite http.SameSite
+	// MaxLifetime>0 caps the lifetime of a session, in seconds, counted from
+	// its creation regardless of activity. Older sessions are treated as new.
+	// It is honoured when set on the store, not on a single session.
+	MaxLifetime int
 }
 
 func (o Options) ToGorillaOptions() *gsessions.Options {
@@ -73,3 +87,86 @@ func (o Options) ToGorillaOptions() *gsessions.Options {
 		SameSite: o.SameSite,
 	}
 }
+
+// StampCreated records the creation time in a session that has none yet.
+func StampCreated(ss *gsessions.Session) {
+	if _, ok := ss.Values[CreatedAtKey]; !ok {
+		ss.Values[CreatedAtKey] = time.Now().Unix()
+	}
+}
+
+// LifetimeExceeded reports whether the session was created more than
+// maxLifetime seconds ago. It is always false if maxLifetime <= 0 or the
+// session has no creation time.
+func LifetimeExceeded(ss *gsessions.Session, maxLifetime int) bool {
+	if maxLifetime <= 0 {
+		return false
+	}
+	var created int64
+	// the type depends on the serializer which decoded the session
+	switch v := ss.Values[CreatedAtKey].(type) {
+	case int64:
+		created = v
+	case int:
+		created = int64(v)
+	case uint64:
+		created = int64(v)
+	case float64:
+		created = int64(v)
+	default:
+		return false
+	}
+	return time.Now().Unix()-created > int64(maxLifetime)
+}
+
+// BoundUser returns the ID of the user the session is bound to, if any.
+func BoundUser(ss *gsessions.Session) (string, bool) {
+	id, ok := ss.Values[UserIDKey].(string)
+	return id, ok && id != ""
+}
+
+// loadedTTLKey is the session value key under which StampTTL records the TTL
+// of the record of the session. Being unexported, it is invisible to users.
+type loadedTTLKey struct{}
+
+type loadedTTL struct {
+	at  time.Time
+	ttl time.Duration
+}
+
+// StampTTL records in the session the TTL its record had when it was loaded,
+// so that stores with sliding expiration can tell with TouchDue whether the
+// record needs touching without another round trip. Stores must call
+// UnstampTTL before serializing the session.
+func StampTTL(ss *gsessions.Session, ttl time.Duration) {
+	ss.Values[loadedTTLKey{}] = loadedTTL{time.Now(), ttl}
+}
+
+// UnstampTTL removes the TTL recorded by StampTTL.
+func UnstampTTL(ss *gsessions.Session) {
+	delete(ss.Values, loadedTTLKey{})
+}
+
+// TouchDue reports whether the TTL of the record of the session, extended to
+// age, would grow by at least interval. It is true when the session has no TTL
+// recorded by StampTTL, leaving the decision to the store.
+func TouchDue(ss *gsessions.Session, age, interval time.Duration) bool {
+	l, ok := ss.Values[loadedTTLKey{}].(loadedTTL)
+	if !ok {
+		return true
+	}
+	return age-(l.ttl-time.Since(l.at)) >= interval
+}
+
+// LimitPolicy is what a store limiting the sessions per user does when a
+// session is bound to a user who already has as many as allowed, see
+// RediStore.SetUserLimit.
+type LimitPolicy int
+
+const (
+	// RejectNewSession fails the Save of the new session with ErrSessionLimit.
+	RejectNewSession LimitPolicy = iota
+	// EvictOldestSession deletes the sessions of the user expiring first, the
+	// least recently saved or touched ones, to make room for the new session.
+	EvictOldestSession
+)
@@ -43,10 +43,11 @@ package sessions
 import (
 	gcontext "context"
 	"net/http"
+	"sync"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/adaptor"
-	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/protocol"
 	"github.com/gorilla/context"
 	"github.com/gorilla/sessions"
 )
@@ -56,11 +57,30 @@ const (
 	errorFormat = "[sessions] ERROR! %s\n"
 )
 
+// Store is the interface of session stores used by the middleware.
+// The *http.Request handed to a store carries the context of the Hertz request,
+// so stores doing I/O should honour the cancellation and deadline of r.Context().
 type Store interface {
 	sessions.Store
 	Options(Options)
 }
 
+// Regenerator is implemented by stores that keep session values server-side.
+// Regenerate removes the record stored under the current session ID and
+// clears the ID, so that the next Save writes the values under a fresh one.
+type Regenerator interface {
+	Regenerate(r *http.Request, session *sessions.Session) error
+}
+
+// Toucher is implemented by stores supporting sliding expiration.
+// Save calls Touch instead of saving when the session was read but not
+// modified, so that the store can extend the lifetime of the session.
+// The middleware also calls it once the handler returned, for sessions
+// read but neither modified nor saved.
+type Toucher interface {
+	Touch(r *http.Request, w http.ResponseWriter, session *sessions.Session) error
+}
+
 // Session Wraps thinly gorilla-session methods.
 // Session stores the values and optional configuration for a session.
 type Session interface {
@@ -72,7 +92,7 @@ type Session interface {
 	Set(key, val interface{})
 	// Delete removes the session value associated to the given key.
 	Delete(key interface{})
-	// Clear deletes all values in the session.
+	// Clear deletes all values in the session, except its creation time.
 	Clear()
 	// AddFlash adds a flash message to the session.
 	// A single variadic argument is accepted, and it is optional: it defines the flash key.
@@ -84,7 +104,22 @@ type Session interface {
 	Flashes(vars ...string) []interface{}
 	// Options sets configuration for a session.
 	Options(Options)
+	// Regenerate issues a fresh ID for the session while keeping its values,
+	// and drops the record stored under the old ID. The new ID is sent to the
+	// client on the next Save. Call it after login to prevent session fixation.
+	Regenerate() error
+	// Err returns the error met loading the session, if any. The session is
+	// then new or partially loaded. The error matches ErrInvalidCookie when
+	// the cookie could not be decoded, and ErrStoreUnavailable when the store
+	// could not reach its backend.
+	Err() error
+	// KeyID returns the ID of the KeyRing key which decoded the session
+	// cookie, e.g. to save again sessions encoded with an old key. It is
+	// empty for a new session, or when the store doesn't use a KeyRing.
+	KeyID() string
 	// Save saves all sessions used during the current request.
+	// A session that was only read is touched instead when the store
+	// supports sliding expiration.
 	Save() error
 }
 
@@ -98,40 +133,198 @@ func SessionsMany(names []string, store Store) app.HandlerFunc {
 	return Many(names, store)
 }
 
-func New(name string, store Store) app.HandlerFunc {
+// New returns a middleware handing the session name of store to the handlers,
+// see Default. The session is only loaded when a handler first uses it, and
+// requests that don't use it pay no allocation, conversion to net/http nor
+// store access.
+// The session must not be used once the handler returned: it is recycled for
+// the following requests.
+func New(name string, store Store, opts ...Option) app.HandlerFunc {
+	o := newOptions(opts...)
+	pool := &sync.Pool{New: func() interface{} { return new(session) }}
 	return func(ctx gcontext.Context, c *app.RequestContext) {
-		req, _ := adaptor.GetCompatRequest(&c.Request)
-		resp := adaptor.GetCompatResponseWriter(&c.Response)
-		s := &session{name, req, store, nil, false, resp}
-		c.Set(DefaultKey, s)
-		defer context.Clear(req)
-		c.Next(ctx)
-		resp.WriteHeader(c.Response.StatusCode())
+		s := pool.Get().(*session)
+		s.reset(name, store, o, &s.own)
+		s.own.reset(ctx, c)
+		bind(c, o.contextKey, s)
+		defer func() {
+			unbind(c, o.contextKey)
+			pool.Put(s)
+		}()
+		if o.unavailable(s) {
+			c.AbortWithStatus(o.unavailableStatus)
+		} else {
+			c.Next(ctx)
+			if err := s.release(); err != nil {
+				s.onError(err)
+			}
+		}
+		s.compat.done()
 	}
 }
 
-func Many(names []string, store Store) app.HandlerFunc {
+// manySessions holds the sessions of the Many middleware for a request.
+type manySessions struct {
+	compat compat
+	ss     []session
+	byName map[string]Session
+}
+
+// Many returns a middleware like New, handing several sessions to the
+// handlers, see DefaultMany.
+func Many(names []string, store Store, opts ...Option) app.HandlerFunc {
+	o := newOptions(opts...)
+	pool := &sync.Pool{New: func() interface{} {
+		m := &manySessions{ss: make([]session, len(names)), byName: make(map[string]Session, len(names))}
+		for i, name := range names {
+			m.byName[name] = &m.ss[i]
+		}
+		return m
+	}}
 	return func(ctx gcontext.Context, c *app.RequestContext) {
-		s := make(map[string]Session, len(names))
-		req, _ := adaptor.GetCompatRequest(&c.Request)
-		resp := adaptor.GetCompatResponseWriter(&c.Response)
-		for _, name := range names {
-			s[name] = &session{name, req, store, nil, false, resp}
+		m := pool.Get().(*manySessions)
+		m.compat.reset(ctx, c)
+		unavailable := false
+		for i, name := range names {
+			m.ss[i].reset(name, store, o, &m.compat)
+			unavailable = unavailable || o.unavailable(&m.ss[i])
+		}
+		bind(c, o.contextKey, m.byName)
+		defer func() {
+			unbind(c, o.contextKey)
+			pool.Put(m)
+		}()
+		if unavailable {
+			c.AbortWithStatus(o.unavailableStatus)
+		} else {
+			c.Next(ctx)
+			for i := range m.ss {
+				if err := m.ss[i].release(); err != nil {
+					m.ss[i].onError(err)
+				}
+			}
+		}
+		m.compat.done()
+	}
+}
+
+// compat converts the Hertz request and response for the gorilla stores,
+// on first use only: requests whose handlers don't touch the sessions pay
+// neither for the conversion nor for copying the headers back.
+type compat struct {
+	ctx gcontext.Context
+	c   *app.RequestContext
+	req *http.Request
+	w   headerWriter
+	// keyIDs holds the IDs of the keys which decoded the session cookies.
+	keyIDs map[string]string
+	// finished is set once the middleware returned, the RequestContext
+	// may then serve another request.
+	finished bool
+}
+
+// reset prepares a recycled compat for a new request, keeping the header map.
+func (h *compat) reset(ctx gcontext.Context, c *app.RequestContext) {
+	w := h.w
+	for key := range w {
+		delete(w, key)
+	}
+	*h = compat{ctx: ctx, c: c, w: w}
+}
+
+// trackKeys records in the context handed to the stores the IDs of the keys
+// decoding the session cookies, see DecodeCookie. It must be called before
+// the compat request is created.
+func (h *compat) trackKeys() {
+	if h.keyIDs == nil && !h.finished {
+		h.keyIDs = make(map[string]string)
+		h.ctx = gcontext.WithValue(h.ctx, keyIDsKey{}, h.keyIDs)
+	}
+}
+
+// request returns the compat request, which carries the Hertz request context
+// so that stores reach it through req.Context().
+func (h *compat) request() *http.Request {
+	if h.req == nil {
+		if h.finished {
+			// never read the cookies of another request
+			h.req = (&http.Request{Header: make(http.Header)}).WithContext(h.ctx)
+			return h.req
+		}
+		req, _ := adaptor.GetCompatRequest(&h.c.Request)
+		h.req = req.WithContext(h.ctx)
+	}
+	return h.req
+}
+
+// writer returns the response writer handed to the stores, call flush once
+// the store returned.
+func (h *compat) writer() http.ResponseWriter {
+	if h.w == nil {
+		h.w = make(headerWriter)
+	}
+	return h.w
+}
+
+// flush copies the headers written by a store to the Hertz response, replacing
+// the values already set under the same header or cookie name. The headers of
+// sessions used after the response was sent are dropped.
+func (h *compat) flush() {
+	for key, values := range h.w {
+		if !h.finished {
+			if key == "Set-Cookie" {
+				cookie := protocol.AcquireCookie()
+				for _, v := range values {
+					if cookie.Parse(v) == nil {
+						h.c.Response.Header.SetCookie(cookie)
+					}
+				}
+				protocol.ReleaseCookie(cookie)
+			} else {
+				h.c.Response.Header.Del(key)
+				for _, v := range values {
+					h.c.Response.Header.Add(key, v)
+				}
+			}
 		}
-		c.Set(DefaultKey, s)
-		defer context.Clear(req)
-		c.Next(ctx)
-		resp.WriteHeader(c.Response.StatusCode())
+		delete(h.w, key)
 	}
 }
 
+// done releases the compat request once the middleware returned.
+func (h *compat) done() {
+	if h.req != nil {
+		context.Clear(h.req)
+	}
+	h.finished = true
+}
+
+// headerWriter is the response writer of the stores, which only write headers.
+type headerWriter http.Header
+
+func (w headerWriter) Header() http.Header { return http.Header(w) }
+
+func (headerWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+func (headerWriter) WriteHeader(int) {}
+
 type session struct {
 	name    string
-	request *http.Request
 	store   Store
 	session *sessions.Session
+	err     error
 	written bool
-	writer  http.ResponseWriter
+	touched bool
+	opts    *options
+	compat  *compat
+	// own holds the compat of a session not sharing it, saving an allocation
+	own compat
+}
+
+// reset prepares a recycled session for a new request.
+func (s *session) reset(name string, store Store, o *options, h *compat) {
+	s.name, s.store, s.opts, s.compat = name, store, o, h
+	s.session, s.err, s.written, s.touched = nil, nil, false, false
 }
 
 func (s *session) ID() string {
@@ -154,6 +347,10 @@ func (s *session) Delete(key interface{}) {
 
 func (s *session) Clear() {
 	for key := range s.Session().Values {
+		// keep the creation time, clearing values must not extend the lifetime
+		if key == CreatedAtKey {
+			continue
+		}
 		s.Delete(key)
 	}
 }
@@ -173,38 +370,144 @@ func (s *session) Options(options Options) {
 	s.Session().Options = options.ToGorillaOptions()
 }
 
+func (s *session) Regenerate() error {
+	ss := s.Session()
+	if rs, ok := s.store.(HertzRegenerator); ok && !s.compat.finished {
+		if err := rs.RegenerateHertz(s.compat.ctx, s.compat.c, ss); err != nil {
+			return err
+		}
+	} else if rs, ok := s.store.(Regenerator); ok {
+		if err := rs.Regenerate(s.compat.request(), ss); err != nil {
+			return err
+		}
+	} else {
+		ss.ID = ""
+	}
+	s.written = true
+	return nil
+}
+
 func (s *session) Save() error {
 	if s.Written() {
-		e := s.Session().Save(s.request, s.writer)
+		var e error
+		if hs, ok := s.native(); ok {
+			e = hs.SaveHertz(s.compat.ctx, s.compat.c, s.Session())
+		} else {
+			e = s.Session().Save(s.compat.request(), s.compat.writer())
+			s.compat.flush()
+		}
 		if e == nil {
 			s.written = false
+			s.touched = true
 		}
 		return e
 	}
-	return nil
+	return s.touch()
+}
+
+// touch lets a store supporting sliding expiration extend the lifetime of a
+// session that was read but not modified.
+func (s *session) touch() error {
+	if s.session == nil {
+		return nil
+	}
+	var e error
+	if t, ok := s.store.(HertzToucher); ok && !s.compat.finished {
+		e = t.TouchHertz(s.compat.ctx, s.compat.c, s.session)
+	} else if t, ok := s.store.(Toucher); ok {
+		e = t.Touch(s.compat.request(), s.compat.writer(), s.session)
+		s.compat.flush()
+	}
+	if e == nil {
+		s.touched = true
+	}
+	return e
+}
+
+// native returns the store as a HertzStore while the request is served.
+func (s *session) native() (HertzStore, bool) {
+	if s.compat.finished {
+		return nil, false
+	}
+	hs, ok := s.store.(HertzStore)
+	return hs, ok
+}
+
+// release runs once the handler returned: it saves the session if it was
+// modified and auto save is enabled, and otherwise touches a session that was
+// read, so that sliding expiration doesn't depend on the handler calling Save.
+func (s *session) release() error {
+	if s.session == nil {
+		return nil
+	}
+	if s.written {
+		if s.opts.autoSave {
+			return s.Save()
+		}
+		return nil
+	}
+	if s.touched || s.err != nil {
+		return nil
+	}
+	return s.touch()
+}
+
+func (s *session) KeyID() string {
+	s.Session()
+	return s.compat.keyIDs[s.name]
+}
+
+func (s *session) Err() error {
+	s.Session()
+	return s.err
 }
 
 func (s *session) Session() *sessions.Session {
 	if s.session == nil {
 		var err error
-		s.session, err = s.store.Get(s.request, s.name)
+		s.compat.trackKeys()
+		if hs, ok := s.native(); ok {
+			s.session, err = hs.GetHertz(s.compat.ctx, s.compat.c, s.name)
+		} else {
+			s.session, err = s.store.Get(s.compat.request(), s.name)
+		}
 		if err != nil {
-			hlog.Errorf(errorFormat, err)
+			s.err = loadError(err)
+			s.onError(s.err)
+		}
+		if s.session == nil {
+			// never hand out a nil session, whatever the store did
+			s.session = sessions.NewSession(s.store, s.name)
 		}
 	}
 	return s.session
 }
 
+// onError passes an error to the error handler of the middleware.
+func (s *session) onError(err error) {
+	s.opts.errorHandler(s.compat.ctx, s.compat.c, err)
+}
+
 func (s *session) Written() bool {
 	return s.written
 }
 
 // Default shortcut to get session
 func Default(c *app.RequestContext) Session {
-	return c.MustGet(DefaultKey).(Session)
+	return DefaultWithKey(c, DefaultKey)
 }
 
 // DefaultMany shortcut to get session with given name
 func DefaultMany(c *app.RequestContext, name string) Session {
-	return c.MustGet(DefaultKey).(map[string]Session)[name]
+	return DefaultManyWithKey(c, DefaultKey, name)
+}
+
+// DefaultWithKey shortcut to get session stored under the given context key
+func DefaultWithKey(c *app.RequestContext, key string) Session {
+	return bound(c, key).(Session)
+}
+
+// DefaultManyWithKey shortcut to get session with given name stored under the given context key
+func DefaultManyWithKey(c *app.RequestContext, key, name string) Session {
+	return bound(c, key).(map[string]Session)[name]
 }
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect selects the SQL flavour of the database: placeholders, column
+// types and upsert statement.
+type Dialect int
+
+const (
+	// SQLite 3.24 or later.
+	SQLite Dialect = iota
+	// PostgreSQL 9.5 or later.
+	PostgreSQL
+	// MySQL 5.6 or later, or MariaDB.
+	MySQL
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case SQLite:
+		return "sqlite"
+	case PostgreSQL:
+		return "postgres"
+	case MySQL:
+		return "mysql"
+	}
+	return "Dialect(" + strconv.Itoa(int(d)) + ")"
+}
+
+// rebind replaces the ? placeholders of query with the ones of the dialect.
+func (d Dialect) rebind(query string) string {
+	if d != PostgreSQL {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Schema returns the statements creating the session table and its index
+// on the expiration time, if they don't exist yet.
+//
+// The table has the columns id, the session key, data, the serialized
+// session, and created_at and expires_at, Unix timestamps in seconds.
+// On MySQL id is a VARBINARY, which keeps the primary key within the 767
+// bytes index limit of InnoDB before 5.7 whatever the table charset.
+func (d Dialect) Schema(table string) []string {
+	switch d {
+	case PostgreSQL:
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARCHAR(255) PRIMARY KEY,
+	data BYTEA NOT NULL,
+	created_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL
+)`, table),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expires_at ON %s (expires_at)", table, table),
+		}
+	case MySQL:
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id VARBINARY(255) NOT NULL PRIMARY KEY,
+	data LONGBLOB NOT NULL,
+	created_at BIGINT NOT NULL,
+	expires_at BIGINT NOT NULL,
+	INDEX %s_expires_at (expires_at)
+)`, table, table),
+		}
+	default:
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id TEXT PRIMARY KEY,
+	data BLOB NOT NULL,
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL
+)`, table),
+			fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expires_at ON %s (expires_at)", table, table),
+		}
+	}
+}
+
+// upsert returns the statement inserting a session, or updating its data
+// and expiration time while keeping its creation time.
+func (d Dialect) upsert(table string) string {
+	if d == MySQL {
+		return fmt.Sprintf("INSERT INTO %s (id, data, created_at, expires_at) VALUES (?, ?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE data = VALUES(data), expires_at = VALUES(expires_at)", table)
+	}
+	return d.rebind(fmt.Sprintf("INSERT INTO %s (id, data, created_at, expires_at) VALUES (?, ?, ?, ?) "+
+		"ON CONFLICT (id) DO UPDATE SET data = excluded.data, expires_at = excluded.expires_at", table))
+}
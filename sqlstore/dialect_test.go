@@ -0,0 +1,36 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlstore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+func TestSQL_Dialect(t *testing.T) {
+	assert.DeepEqual(t, "INSERT INTO s (id, data, created_at, expires_at) VALUES ($1, $2, $3, $4) "+
+		"ON CONFLICT (id) DO UPDATE SET data = excluded.data, expires_at = excluded.expires_at", PostgreSQL.upsert("s"))
+	assert.DeepEqual(t, "INSERT INTO s (id, data, created_at, expires_at) VALUES (?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE data = VALUES(data), expires_at = VALUES(expires_at)", MySQL.upsert("s"))
+	assert.DeepEqual(t, "DELETE FROM s WHERE id = ?", SQLite.rebind("DELETE FROM s WHERE id = ?"))
+	assert.DeepEqual(t, 1, len(MySQL.Schema("s")))
+	assert.True(t, strings.Contains(MySQL.Schema("s")[0], "id VARBINARY(255)"))
+	assert.DeepEqual(t, 2, len(PostgreSQL.Schema("s")))
+	assert.DeepEqual(t, "postgres", PostgreSQL.String())
+}
@@ -0,0 +1,296 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	hs "github.com/hertz-contrib/sessions"
+)
+
+// Amount of time for cookies to expire.
+var sessionExpire = 86400 * 30
+
+// Store stores sessions in a table of a database/sql database, see
+// Dialect.Schema for its layout. The driver of the database must be
+// imported by the application.
+// Only the securecookie-encoded session ID is sent to the client.
+type Store struct {
+	DB            *sql.DB
+	Codecs        []securecookie.Codec
+	Opts          *sessions.Options // default configuration
+	DefaultMaxAge int               // default TTL for a MaxAge == 0 session
+	maxLength     int
+	maxLifetime   int
+	keyPrefix     string
+	table         string
+	dialect       Dialect
+	serializer    hs.Serializer
+
+	done chan struct{}
+	once sync.Once
+}
+
+func (s *Store) Options(options hs.Options) {
+	s.Opts = options.ToGorillaOptions()
+	s.maxLifetime = options.MaxLifetime
+}
+
+// NewStore returns a new sqlstore.Store storing the sessions in the table
+// "sessions" of db, which removes expired sessions every minute.
+// The table can be created with CreateTable.
+func NewStore(db *sql.DB, dialect Dialect, kvs ...[]byte) *Store {
+	return NewStoreWithCleanup(db, dialect, time.Minute, kvs...)
+}
+
+// NewStoreWithCleanup returns a new sqlstore.Store whose janitor removes
+// expired sessions every interval. If interval <= 0 no janitor is started
+// and expired sessions are only ignored when they are read, see DeleteExpired.
+func NewStoreWithCleanup(db *sql.DB, dialect Dialect, interval time.Duration, kvs ...[]byte) *Store {
+	s := &Store{
+		DB:     db,
+		Codecs: securecookie.CodecsFromPairs(kvs...),
+		Opts: &sessions.Options{
+			Path:   "/",
+			MaxAge: sessionExpire,
+		},
+		DefaultMaxAge: 60 * 20, // 20 minutes seems like a reasonable default
+		maxLength:     4096,
+		keyPrefix:     "session_",
+		table:         "sessions",
+		dialect:       dialect,
+		serializer:    hs.GobSerializer{},
+		done:          make(chan struct{}),
+	}
+	if interval > 0 {
+		go s.janitor(interval)
+	}
+	return s
+}
+
+// Close stops the janitor of the store. The database is left open.
+func (s *Store) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// SetMaxLength sets Store.maxLength if the `l` argument is greater or equal 0
+// maxLength restricts the maximum length of new sessions to l.
+// If l is 0 there is no limit to the size of a session, use with caution.
+// The default is 4096.
+func (s *Store) SetMaxLength(l int) {
+	if l >= 0 {
+		s.maxLength = l
+	}
+}
+
+// SetKeyPrefix set the prefix
+func (s *Store) SetKeyPrefix(p string) {
+	s.keyPrefix = p
+}
+
+// SetSerializer sets the serializer
+func (s *Store) SetSerializer(ss hs.Serializer) {
+	s.serializer = ss
+}
+
+// SetTable sets the name of the session table, "sessions" by default.
+// The name is used as is in the statements, it must not come from users.
+func (s *Store) SetTable(table string) {
+	s.table = table
+}
+
+// SetMaxAge restricts the maximum age, in seconds, of the session row
+// and the cookie.
+//
+// See RediStore.SetMaxAge.
+func (s *Store) SetMaxAge(v int) {
+	s.Opts.MaxAge = v
+	hs.SetCodecsMaxAge(s.Codecs, v)
+}
+
+// SetMaxLifetime caps the lifetime, in seconds, of the sessions of the store
+// counted from their creation regardless of activity. Older sessions are
+// deleted and treated as new. Set it to 0 for no restriction.
+func (s *Store) SetMaxLifetime(v int) {
+	s.maxLifetime = v
+}
+
+// CreateTable creates the session table and its index if they don't exist.
+func (s *Store) CreateTable(ctx context.Context) error {
+	for _, stmt := range s.dialect.Schema(s.table) {
+		if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a session for the given name after adding it to the registry.
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New returns a session for the given name without adding it to the registry.
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	var (
+		err error
+		ok  bool
+	)
+	session := sessions.NewSession(s, name)
+	// make a copy
+	options := *s.Opts
+	session.Options = &options
+	session.IsNew = true
+	if c, errCookie := r.Cookie(name); errCookie == nil {
+		err = hs.DecodeCookie(r.Context(), name, c.Value, &session.ID, s.Codecs...)
+		if err == nil {
+			ok, err = s.load(r.Context(), session)
+			session.IsNew = !(err == nil && ok) // not new if no error and data available
+		}
+	}
+	if err == nil && hs.LifetimeExceeded(session, s.maxLifetime) {
+		// The session outlived its absolute lifetime, start over.
+		err = s.delete(r.Context(), session)
+		session.ID = ""
+		session.Values = make(map[interface{}]interface{})
+		session.IsNew = true
+	}
+	if s.maxLifetime > 0 {
+		hs.StampCreated(session)
+	}
+	return session, err
+}
+
+// Save adds a single session to the response.
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	// Marked for deletion.
+	if session.Options.MaxAge < 0 {
+		if err := s.delete(r.Context(), session); err != nil {
+			return err
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	if err := s.save(r.Context(), session); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// Regenerate removes the session row and clears the session ID,
+// so that the next Save stores the values under a fresh ID.
+func (s *Store) Regenerate(r *http.Request, session *sessions.Session) error {
+	if err := s.delete(r.Context(), session); err != nil {
+		return err
+	}
+	session.ID = ""
+	return nil
+}
+
+// DeleteExpired removes the expired sessions from the table.
+func (s *Store) DeleteExpired(ctx context.Context) error {
+	query := s.dialect.rebind(fmt.Sprintf("DELETE FROM %s WHERE expires_at <= ?", s.table))
+	_, err := s.DB.ExecContext(ctx, query, time.Now().Unix())
+	return err
+}
+
+// age returns the TTL of the session.
+func (s *Store) age(session *sessions.Session) time.Duration {
+	age := session.Options.MaxAge
+	if age == 0 {
+		age = s.DefaultMaxAge
+	}
+	return time.Duration(age) * time.Second
+}
+
+// save stores the session in the table.
+func (s *Store) save(ctx context.Context, session *sessions.Session) error {
+	b, err := s.serializer.Serialize(session)
+	if err != nil {
+		return err
+	}
+	if s.maxLength != 0 && len(b) > s.maxLength {
+		return errors.New("sqlstore: the value to store is too big")
+	}
+	now := time.Now()
+	_, err = s.DB.ExecContext(ctx, s.dialect.upsert(s.table),
+		s.keyPrefix+session.ID, b, now.Unix(), now.Add(s.age(session)).Unix())
+	return err
+}
+
+// load reads the session from the table.
+// returns true if there is a live session row
+func (s *Store) load(ctx context.Context, session *sessions.Session) (bool, error) {
+	query := s.dialect.rebind(fmt.Sprintf("SELECT data FROM %s WHERE id = ? AND expires_at > ?", s.table))
+	var b []byte
+	err := s.DB.QueryRowContext(ctx, query, s.keyPrefix+session.ID, time.Now().Unix()).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil // no data was associated with this key
+	}
+	if err != nil {
+		return false, hs.Unavailable(err)
+	}
+	return true, s.serializer.Deserialize(b, session)
+}
+
+// delete removes the session row.
+func (s *Store) delete(ctx context.Context, session *sessions.Session) error {
+	if session.ID == "" {
+		return nil
+	}
+	query := s.dialect.rebind(fmt.Sprintf("DELETE FROM %s WHERE id = ?", s.table))
+	_, err := s.DB.ExecContext(ctx, query, s.keyPrefix+session.ID)
+	return err
+}
+
+// janitor periodically removes expired sessions until the store is closed.
+func (s *Store) janitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.DeleteExpired(context.Background()); err != nil {
+				hlog.Warnf("sqlstore: delete expired sessions: %v", err)
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,163 @@
+//go:build cgo
+// +build cgo
+
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/hertz-contrib/sessions"
+	"github.com/hertz-contrib/sessions/tester"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openDB opens a SQLite database with github.com/mattn/go-sqlite3, which
+// requires cgo.
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var newStore = func(t *testing.T) sessions.Store {
+	store := NewStoreWithCleanup(openDB(t), SQLite, 0, []byte("secret"))
+	if err := store.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSQL_SessionGetSet(t *testing.T) {
+	tester.GetSet(t, newStore)
+}
+
+func TestSQL_SessionDeleteKey(t *testing.T) {
+	tester.DeleteKey(t, newStore)
+}
+
+func TestSQL_SessionFlashes(t *testing.T) {
+	tester.Flashes(t, newStore)
+}
+
+func TestSQL_SessionClear(t *testing.T) {
+	tester.Clear(t, newStore)
+}
+
+func TestSQL_SessionOptions(t *testing.T) {
+	tester.Options(t, newStore)
+}
+
+func TestSQL_SessionMany(t *testing.T) {
+	tester.Many(t, newStore)
+}
+
+func TestSQL_SessionRegenerate(t *testing.T) {
+	tester.Regenerate(t, newStore)
+}
+
+func TestSQL_SessionMaxLifetime(t *testing.T) {
+	tester.MaxLifetime(t, newStore)
+}
+
+func TestSQL_SessionAutoSave(t *testing.T) {
+	tester.AutoSave(t, newStore)
+}
+
+func TestSQL_SessionContextKey(t *testing.T) {
+	tester.ContextKey(t, newStore)
+}
+
+func TestSQL_SessionInvalidCookie(t *testing.T) {
+	tester.InvalidCookie(t, newStore)
+}
+
+func TestSQL_SessionGetAs(t *testing.T) {
+	tester.GetAs(t, newStore)
+	tester.GetAs(t, func(t *testing.T) sessions.Store {
+		store := newStore(t).(*Store)
+		store.SetSerializer(sessions.JSONSerializer{})
+		return store
+	})
+}
+
+func TestSQL_SessionLazy(t *testing.T) {
+	tester.Lazy(t, newStore)
+}
+
+func TestSQL_SessionKeyRing(t *testing.T) {
+	tester.KeyRing(t, func(t *testing.T, ring *sessions.KeyRing) sessions.Store {
+		store := newStore(t).(*Store)
+		store.Codecs = ring.Codecs()
+		return store
+	})
+}
+
+func TestSQL_Store(t *testing.T) {
+	ctx := context.Background()
+	store := NewStoreWithCleanup(openDB(t), SQLite, 0, []byte("secret"))
+	store.SetTable("web_sessions")
+	store.SetKeyPrefix("web_")
+	assert.Nil(t, store.CreateTable(ctx))
+	// the schema helpers can run again
+	assert.Nil(t, store.CreateTable(ctx))
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/", nil)
+	session, err := store.New(req, "session-key")
+	assert.Nil(t, err)
+	session.Values["key"] = "val"
+	assert.Nil(t, store.Save(req, httptest.NewRecorder(), session))
+
+	var id string
+	var created, expires int64
+	row := store.DB.QueryRow("SELECT id, created_at, expires_at FROM web_sessions")
+	assert.Nil(t, row.Scan(&id, &created, &expires))
+	assert.DeepEqual(t, "web_"+session.ID, id)
+	assert.DeepEqual(t, int64(sessionExpire), expires-created)
+
+	// updating keeps the creation time
+	_, err = store.DB.Exec("UPDATE web_sessions SET created_at = 1")
+	assert.Nil(t, err)
+	session.Values["key"] = "updated"
+	assert.Nil(t, store.Save(req, httptest.NewRecorder(), session))
+	assert.Nil(t, store.DB.QueryRow("SELECT created_at FROM web_sessions").Scan(&created))
+	assert.DeepEqual(t, int64(1), created)
+
+	// expired rows are ignored, then deleted
+	_, err = store.DB.Exec("UPDATE web_sessions SET expires_at = 1")
+	assert.Nil(t, err)
+	ok, err := store.load(ctx, session)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, store.DeleteExpired(ctx))
+	var n int
+	assert.Nil(t, store.DB.QueryRow("SELECT COUNT(*) FROM web_sessions").Scan(&n))
+	assert.DeepEqual(t, 0, n)
+
+	session.Values["big"] = make([]byte, 8192)
+	assert.NotNil(t, store.Save(req, httptest.NewRecorder(), session))
+}
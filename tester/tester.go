@@ -42,9 +42,13 @@ package tester
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/adaptor"
@@ -324,3 +328,550 @@ func Many(t *testing.T, newStore storeFactory) {
 		Value: header,
 	})
 }
+
+func Regenerate(t *testing.T, newStore storeFactory) {
+	opt := config.NewOptions([]config.Option{})
+	r := route.NewEngine(opt)
+	r.Use(sessions.New(sessionName, newStore(t)))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		session.Set("key", ok)
+		_ = session.Save()
+		c.String(consts.StatusOK, ok)
+	})
+
+	r.GET("/regenerate", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		oldID := session.ID()
+		if err := session.Regenerate(); err != nil {
+			t.Error("Session regenerating failed:", err)
+		}
+		_ = session.Save()
+		if oldID != "" && session.ID() == oldID {
+			t.Error("Session ID was not regenerated")
+		}
+		c.String(http.StatusOK, ok)
+	})
+
+	r.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if session.Get("key") != ok {
+			t.Error("Session values were lost on regeneration")
+		}
+		c.String(http.StatusOK, ok)
+	})
+
+	r.GET("/old", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if session.ID() != "" && session.Get("key") != nil {
+			t.Error("Session stored under the old ID was not removed")
+		}
+		c.String(http.StatusOK, ok)
+	})
+
+	w1 := ut.PerformRequest(r, consts.MethodGet, "/set", nil)
+	res1 := w1.Result()
+	oldCookie := strings.Join(adaptor.GetCompatResponseWriter(res1).Header().Values("Set-Cookie"), "; ")
+
+	w2 := ut.PerformRequest(r, consts.MethodGet, "/regenerate", nil, ut.Header{
+		Key:   "Cookie",
+		Value: oldCookie,
+	})
+	res2 := w2.Result()
+	newCookie := strings.Join(adaptor.GetCompatResponseWriter(res2).Header().Values("Set-Cookie"), "; ")
+	if newCookie == "" {
+		t.Fatal("No cookie was set after regeneration")
+	}
+
+	_ = ut.PerformRequest(r, consts.MethodGet, "/get", nil, ut.Header{
+		Key:   "Cookie",
+		Value: newCookie,
+	})
+	_ = ut.PerformRequest(r, consts.MethodGet, "/old", nil, ut.Header{
+		Key:   "Cookie",
+		Value: oldCookie,
+	})
+}
+
+func MaxLifetime(t *testing.T, newStore storeFactory) {
+	opt := config.NewOptions([]config.Option{})
+	r := route.NewEngine(opt)
+	store := newStore(t)
+	store.Options(sessions.Options{
+		Path:        "/",
+		MaxAge:      3600,
+		MaxLifetime: 3600,
+	})
+	r.Use(sessions.New(sessionName, store))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		session.Set("key", ok)
+		_ = session.Save()
+		c.String(consts.StatusOK, ok)
+	})
+
+	r.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if session.Get("key") != ok {
+			t.Error("Session writing failed")
+		}
+		if session.Get(sessions.CreatedAtKey) == nil {
+			t.Error("Session creation time was not recorded")
+		}
+		c.String(http.StatusOK, ok)
+	})
+
+	r.GET("/age", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		session.Set(sessions.CreatedAtKey, time.Now().Add(-2*time.Hour).Unix())
+		_ = session.Save()
+		c.String(http.StatusOK, ok)
+	})
+
+	r.GET("/check", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if session.Get("key") != nil {
+			t.Error("Session outlived its maximum lifetime")
+		}
+		c.String(http.StatusOK, ok)
+	})
+
+	w1 := ut.PerformRequest(r, consts.MethodGet, "/set", nil)
+	cookie := strings.Join(adaptor.GetCompatResponseWriter(w1.Result()).Header().Values("Set-Cookie"), "; ")
+	_ = ut.PerformRequest(r, consts.MethodGet, "/get", nil, ut.Header{
+		Key:   "Cookie",
+		Value: cookie,
+	})
+	w2 := ut.PerformRequest(r, consts.MethodGet, "/age", nil, ut.Header{
+		Key:   "Cookie",
+		Value: cookie,
+	})
+	_ = ut.PerformRequest(r, consts.MethodGet, "/check", nil, ut.Header{
+		Key:   "Cookie",
+		Value: strings.Join(adaptor.GetCompatResponseWriter(w2.Result()).Header().Values("Set-Cookie"), "; "),
+	})
+}
+
+func AutoSave(t *testing.T, newStore storeFactory) {
+	opt := config.NewOptions([]config.Option{})
+	r := route.NewEngine(opt)
+	r.Use(sessions.New(sessionName, newStore(t), sessions.WithAutoSave(true), sessions.WithErrorHandler(
+		func(ctx context.Context, c *app.RequestContext, err error) {
+			t.Error("Session saving failed:", err)
+		},
+	)))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		session.Set("key", ok)
+		c.String(consts.StatusOK, ok)
+	})
+
+	r.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if session.Get("key") != ok {
+			t.Error("Session was not saved automatically")
+		}
+		c.String(http.StatusOK, ok)
+	})
+
+	w1 := ut.PerformRequest(r, consts.MethodGet, "/set", nil)
+	cookies := adaptor.GetCompatResponseWriter(w1.Result()).Header().Values("Set-Cookie")
+	if len(cookies) == 0 {
+		t.Fatal("No cookie was set by the automatic save")
+	}
+
+	_ = ut.PerformRequest(r, consts.MethodGet, "/get", nil, ut.Header{
+		Key:   "Cookie",
+		Value: strings.Join(cookies, "; "),
+	})
+}
+
+func ContextKey(t *testing.T, newStore storeFactory) {
+	opt := config.NewOptions([]config.Option{})
+	r := route.NewEngine(opt)
+	store := newStore(t)
+	r.Use(sessions.New("a", store, sessions.WithContextKey("a")))
+	r.Use(sessions.New("b", store, sessions.WithContextKey("b")))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		sessionA := sessions.DefaultWithKey(c, "a")
+		sessionA.Set("hello", "world")
+		_ = sessionA.Save()
+
+		sessionB := sessions.DefaultWithKey(c, "b")
+		sessionB.Set("foo", "bar")
+		_ = sessionB.Save()
+		c.String(http.StatusOK, ok)
+	})
+
+	r.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+		if _, exists := c.Get(sessions.DefaultKey); exists {
+			t.Error("Session stored under the default key")
+		}
+		if sessions.DefaultWithKey(c, "a").Get("hello") != "world" {
+			t.Error("Session writing failed")
+		}
+		if sessions.DefaultWithKey(c, "b").Get("foo") != "bar" {
+			t.Error("Session writing failed")
+		}
+		c.String(http.StatusOK, ok)
+	})
+
+	w1 := ut.PerformRequest(r, consts.MethodGet, "/set", nil)
+	res1 := adaptor.GetCompatResponseWriter(w1.Result())
+	header := ""
+	for _, x := range res1.Header()["Set-Cookie"] {
+		header += strings.Split(x, ";")[0] + "; \n"
+	}
+	_ = ut.PerformRequest(r, consts.MethodGet, "/get", nil, ut.Header{
+		Key:   "Cookie",
+		Value: header,
+	})
+}
+
+func InvalidCookie(t *testing.T, newStore storeFactory) {
+	opt := config.NewOptions([]config.Option{})
+	r := route.NewEngine(opt)
+	r.Use(sessions.New(sessionName, newStore(t)))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if err := session.Err(); !errors.Is(err, sessions.ErrInvalidCookie) {
+			t.Error("Expected an invalid cookie error, got", err)
+		}
+		session.Set("key", ok)
+		if err := session.Save(); err != nil {
+			t.Error("Session saving failed:", err)
+		}
+		c.String(consts.StatusOK, ok)
+	})
+
+	w1 := ut.PerformRequest(r, consts.MethodGet, "/set", nil, ut.Header{
+		Key:   "Cookie",
+		Value: sessionName + "=tampered",
+	})
+	if len(adaptor.GetCompatResponseWriter(w1.Result()).Header().Values("Set-Cookie")) == 0 {
+		t.Error("No cookie was set for the new session")
+	}
+}
+
+type keyRingStoreFactory func(*testing.T, *sessions.KeyRing) sessions.Store
+
+func KeyRing(t *testing.T, newStore keyRingStoreFactory) {
+	oldKey := sessions.Key{ID: "old", HashKey: []byte("old-hash-key"), BlockKey: []byte("old-block-key-16")}
+	newKey := sessions.Key{ID: "new", HashKey: []byte("new-hash-key")}
+	ring, err := sessions.NewKeyRing(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.Close()
+
+	opt := config.NewOptions([]config.Option{})
+	r := route.NewEngine(opt)
+	r.Use(sessions.New(sessionName, newStore(t, ring)))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if id := session.KeyID(); id != "" {
+			t.Error("Expected no key for a new session, got", id)
+		}
+		session.Set("key", ok)
+		_ = session.Save()
+		c.String(consts.StatusOK, ok)
+	})
+
+	r.GET("/resave", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if session.Get("key") != ok {
+			t.Error("Session decoded with the old key was lost")
+		}
+		if id := session.KeyID(); id != "old" {
+			t.Error("Expected the session to be decoded with the old key, got", id)
+		}
+		session.Set("count", 1)
+		_ = session.Save()
+		c.String(consts.StatusOK, ok)
+	})
+
+	r.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if session.Get("key") != ok {
+			t.Error("Session was not re-encoded with the new key")
+		}
+		if id := session.KeyID(); id != "new" {
+			t.Error("Expected the session to be decoded with the new key, got", id)
+		}
+		c.String(consts.StatusOK, ok)
+	})
+
+	r.GET("/old", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if !errors.Is(session.Err(), sessions.ErrInvalidCookie) || session.Get("key") != nil {
+			t.Error("Session encoded with a dropped key was accepted")
+		}
+		c.String(consts.StatusOK, ok)
+	})
+
+	w1 := ut.PerformRequest(r, consts.MethodGet, "/set", nil)
+	oldCookie := strings.Join(adaptor.GetCompatResponseWriter(w1.Result()).Header().Values("Set-Cookie"), "; ")
+
+	if err = ring.Set(newKey, oldKey); err != nil {
+		t.Fatal(err)
+	}
+	w2 := ut.PerformRequest(r, consts.MethodGet, "/resave", nil, ut.Header{
+		Key:   "Cookie",
+		Value: oldCookie,
+	})
+	newCookie := strings.Join(adaptor.GetCompatResponseWriter(w2.Result()).Header().Values("Set-Cookie"), "; ")
+
+	if err = ring.Set(newKey); err != nil {
+		t.Fatal(err)
+	}
+	_ = ut.PerformRequest(r, consts.MethodGet, "/get", nil, ut.Header{
+		Key:   "Cookie",
+		Value: newCookie,
+	})
+	_ = ut.PerformRequest(r, consts.MethodGet, "/old", nil, ut.Header{
+		Key:   "Cookie",
+		Value: oldCookie,
+	})
+}
+
+func Lazy(t *testing.T, newStore storeFactory) {
+	opt := config.NewOptions([]config.Option{})
+	r := route.NewEngine(opt)
+	r.Use(sessions.New(sessionName, newStore(t), sessions.WithAutoSave(true)))
+	r.GET("/static", func(ctx context.Context, c *app.RequestContext) {
+		c.Header("X-Test", ok)
+		c.String(consts.StatusOK, ok)
+	})
+
+	r.GET("/late", func(ctx context.Context, c *app.RequestContext) {
+		c.Header("X-Test", ok)
+		c.String(consts.StatusCreated, ok)
+		// the session is touched after the response was written
+		sessions.Default(c).Set("key", ok)
+	})
+
+	w1 := ut.PerformRequest(r, consts.MethodGet, "/static", nil)
+	res1 := w1.Result()
+	if len(res1.Header.Peek("Set-Cookie")) != 0 {
+		t.Error("Untouched session set a cookie")
+	}
+	if string(res1.Header.Peek("X-Test")) != ok || string(res1.Body()) != ok {
+		t.Error("Response of untouched session was changed")
+	}
+
+	var retained sessions.Session
+	r.GET("/retain", func(ctx context.Context, c *app.RequestContext) {
+		retained = sessions.Default(c)
+		c.String(consts.StatusOK, ok)
+	})
+
+	w2 := ut.PerformRequest(r, consts.MethodGet, "/late", nil)
+	res2 := w2.Result()
+	if len(res2.Header.Peek("Set-Cookie")) == 0 {
+		t.Error("Session touched late was not saved")
+	}
+	if string(res2.Header.Peek("X-Test")) != ok || string(res2.Body()) != ok ||
+		res2.StatusCode() != consts.StatusCreated || !strings.HasPrefix(string(res2.Header.ContentType()), "text/plain") {
+		t.Error("Response written before the session was touched was changed:", string(res2.Header.Header()))
+	}
+
+	_ = ut.PerformRequest(r, consts.MethodGet, "/retain", nil, ut.Header{
+		Key:   "Cookie",
+		Value: strings.Join(adaptor.GetCompatResponseWriter(res2).Header().Values("Set-Cookie"), "; "),
+	})
+	// the RequestContext may serve another request once the handler returned
+	if retained.Get("key") != nil {
+		t.Error("Session first used after the request read its cookies")
+	}
+
+	r.GET("/headers", func(ctx context.Context, c *app.RequestContext) {
+		c.Header("X-Before", "1")
+		c.Header("X-Deleted", "1")
+		session := sessions.Default(c)
+		session.Set("key", ok)
+		_ = session.Save()
+		session.Set("key", ok+ok)
+		_ = session.Save()
+		c.Header("X-Before", "2")
+		c.Header("X-After", "1")
+		c.Response.Header.Del("X-Deleted")
+		c.String(consts.StatusOK, ok)
+	})
+
+	w3 := ut.PerformRequest(r, consts.MethodGet, "/headers", nil)
+	res3 := adaptor.GetCompatResponseWriter(w3.Result()).Header()
+	if v := res3.Values("X-Before"); len(v) != 1 || v[0] != "2" {
+		t.Error("Header set before Save was not replaced:", v)
+	}
+	if v := res3.Values("X-After"); len(v) != 1 || v[0] != "1" {
+		t.Error("Header set after Save was not sent:", v)
+	}
+	if v := res3.Values("X-Deleted"); len(v) != 0 {
+		t.Error("Header deleted after Save was sent:", v)
+	}
+	if v := res3.Values("Set-Cookie"); len(v) != 1 {
+		t.Error("Expected a single session cookie, got", v)
+	}
+}
+
+func Native(t *testing.T, newStore storeFactory) {
+	store := newStore(t)
+	hs, isNative := store.(sessions.HertzStore)
+	if !isNative {
+		t.Fatalf("%T does not implement sessions.HertzStore", store)
+	}
+	opt := config.NewOptions([]config.Option{})
+	r := route.NewEngine(opt)
+	r.Use(sessions.New(sessionName, store))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		session.Set("key", ok)
+		session.Options(sessions.Options{
+			Path:     "/",
+			MaxAge:   3600,
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		_ = session.Save()
+		c.String(http.StatusOK, ok)
+	})
+	r.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+		if v := sessions.Default(c).Get("key"); v != ok {
+			t.Errorf("Session read from the Hertz request: %v", v)
+		}
+		c.String(http.StatusOK, ok)
+	})
+	r.GET("/expire", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		session.Options(sessions.Options{MaxAge: -1})
+		_ = session.Save()
+		c.String(http.StatusOK, ok)
+	})
+
+	res1 := ut.PerformRequest(r, consts.MethodGet, "/set", nil).Result()
+	cookies := adaptor.GetCompatResponseWriter(res1).Header().Values("Set-Cookie")
+	if len(cookies) == 0 {
+		t.Fatal("Session saved without a cookie")
+	}
+	cookie := strings.ToLower(cookies[0])
+	for _, attr := range []string{"max-age=3600", "path=/", "secure", "httponly", "samesite=strict"} {
+		if !strings.Contains(cookie, attr) {
+			t.Errorf("Cookie %q misses %s", cookies[0], attr)
+		}
+	}
+
+	header := ut.Header{Key: "Cookie", Value: strings.Split(cookies[0], ";")[0]}
+	_ = ut.PerformRequest(r, consts.MethodGet, "/get", nil, header)
+
+	c := app.NewContext(0)
+	c.Request.Header.Set("Cookie", header.Value)
+	if session, err := hs.GetHertz(context.Background(), c, sessionName); err != nil || session.Values["key"] != ok {
+		t.Errorf("Session read with GetHertz: %v, %v", session.Values["key"], err)
+	}
+
+	// the cookie written for Hertz is read the same way through net/http
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Cookie", header.Value)
+	session, err := store.New(req, sessionName)
+	if err != nil || session.Values["key"] != ok {
+		t.Errorf("Session read from the net/http request: %v, %v", session.Values["key"], err)
+	}
+
+	res2 := ut.PerformRequest(r, consts.MethodGet, "/expire", nil, header).Result()
+	expired := adaptor.GetCompatResponseWriter(res2).Header().Values("Set-Cookie")
+	if len(expired) == 0 || !strings.Contains(strings.ToLower(expired[0]), "expires=thu, 01 jan 1970") {
+		t.Errorf("Deleted session did not expire its cookie: %q", expired)
+	}
+
+	if _, ok := store.(sessions.HertzRegenerator); !ok {
+		return
+	}
+	r.GET("/regenerate", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if err := session.Regenerate(); err != nil {
+			t.Error("Regenerate failed:", err)
+		}
+		_ = session.Save()
+		c.String(http.StatusOK, ok)
+	})
+	res3 := ut.PerformRequest(r, consts.MethodGet, "/set", nil).Result()
+	old := ut.Header{Key: "Cookie", Value: strings.Split(adaptor.GetCompatResponseWriter(res3).Header().Get("Set-Cookie"), ";")[0]}
+	res4 := ut.PerformRequest(r, consts.MethodGet, "/regenerate", nil, old).Result()
+	regenerated := strings.Split(adaptor.GetCompatResponseWriter(res4).Header().Get("Set-Cookie"), ";")[0]
+	if regenerated == "" || regenerated == old.Value {
+		t.Errorf("Regenerated session kept its cookie: %q", regenerated)
+	}
+	_ = ut.PerformRequest(r, consts.MethodGet, "/get", nil, ut.Header{Key: "Cookie", Value: regenerated})
+	c = app.NewContext(0)
+	c.Request.Header.Set("Cookie", old.Value)
+	if session, err := hs.GetHertz(context.Background(), c, sessionName); err != nil || !session.IsNew {
+		t.Errorf("Session found under its old ID: %v, %v", session.Values, err)
+	}
+}
+
+type transportStoreFactory func(*testing.T, sessions.Transport) sessions.Store
+
+func Transport(t *testing.T, newStore transportStoreFactory) {
+	bearer := sessions.HeaderTransport{Header: "Authorization", Scheme: "Bearer", ResponseHeader: "X-Session-Token"}
+	newEngine := func(transport sessions.Transport) *route.Engine {
+		r := route.NewEngine(config.NewOptions([]config.Option{}))
+		r.Use(sessions.New(sessionName, newStore(t, transport)))
+		r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+			session := sessions.Default(c)
+			session.Set("key", ok)
+			_ = session.Save()
+			c.String(http.StatusOK, ok)
+		})
+		r.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+			c.String(http.StatusOK, fmt.Sprint(sessions.Default(c).Get("key")))
+		})
+		r.GET("/delete", func(ctx context.Context, c *app.RequestContext) {
+			session := sessions.Default(c)
+			session.Options(sessions.Options{MaxAge: -1})
+			_ = session.Save()
+			c.String(http.StatusOK, ok)
+		})
+		return r
+	}
+
+	r := newEngine(bearer)
+	res1 := ut.PerformRequest(r, consts.MethodGet, "/set", nil).Result()
+	token := string(res1.Header.Peek("X-Session-Token"))
+	if token == "" || len(res1.Header.Peek("Set-Cookie")) != 0 {
+		t.Fatalf("Header transport sent %q, Set-Cookie %q", token, res1.Header.Peek("Set-Cookie"))
+	}
+	for header, want := range map[string]string{
+		"Bearer " + token: ok,
+		"bearer " + token: ok,
+		"Digest " + token: "<nil>",
+		token:             "<nil>",
+	} {
+		res := ut.PerformRequest(r, consts.MethodGet, "/get", nil, ut.Header{Key: "Authorization", Value: header}).Result()
+		if got := string(res.Body()); got != want {
+			t.Errorf("Authorization %q read %s, want %s", header[:6], got, want)
+		}
+	}
+	res2 := ut.PerformRequest(r, consts.MethodGet, "/delete", nil, ut.Header{Key: "Authorization", Value: "Bearer " + token}).Result()
+	if !strings.Contains(string(res2.Header.Header()), "X-Session-Token: \r\n") {
+		t.Errorf("Deleted session did not clear its token: %q", res2.Header.Header())
+	}
+	res3 := ut.PerformRequest(r, consts.MethodGet, "/get", nil, ut.Header{Key: "Authorization", Value: "Bearer " + token}).Result()
+	if string(res3.Body()) != "<nil>" {
+		t.Error("Deleted session was read with its token")
+	}
+
+	// browsers send the cookie, other clients the query parameter
+	r = newEngine(sessions.ChainTransport{sessions.CookieTransport{}, sessions.QueryTransport{Param: "session"}})
+	res4 := ut.PerformRequest(r, consts.MethodGet, "/set", nil).Result()
+	cookies := adaptor.GetCompatResponseWriter(res4).Header().Values("Set-Cookie")
+	if len(cookies) == 0 {
+		t.Fatal("Chained cookie transport set no cookie")
+	}
+	cookie := strings.Split(cookies[0], ";")[0]
+	res5 := ut.PerformRequest(r, consts.MethodGet, "/get", nil, ut.Header{Key: "Cookie", Value: cookie}).Result()
+	res6 := ut.PerformRequest(r, consts.MethodGet, "/get?session="+url.QueryEscape(strings.TrimPrefix(cookie, sessionName+"=")), nil).Result()
+	if string(res5.Body()) != ok || string(res6.Body()) != ok {
+		t.Errorf("Chained transports read %s and %s", res5.Body(), res6.Body())
+	}
+}
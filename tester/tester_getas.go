@@ -0,0 +1,72 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tester
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/adaptor"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/sessions"
+)
+
+func GetAs(t *testing.T, newStore storeFactory) {
+	opt := config.NewOptions([]config.Option{})
+	r := route.NewEngine(opt)
+	r.Use(sessions.New(sessionName, newStore(t)))
+	r.GET("/set", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		session.Set("int", 42)
+		session.Set("strings", []string{"foo", "bar"})
+		session.Set("key", ok)
+		_ = session.Save()
+		c.String(consts.StatusOK, ok)
+	})
+
+	r.GET("/get", func(ctx context.Context, c *app.RequestContext) {
+		session := sessions.Default(c)
+		if v, found, err := sessions.GetAs[int](session, "int"); !found || err != nil || v != 42 {
+			t.Error("Typed reading of int failed:", v, found, err)
+		}
+		if v, found, err := sessions.GetAs[[]string](session, "strings"); !found || err != nil || len(v) != 2 || v[1] != "bar" {
+			t.Error("Typed reading of []string failed:", v, found, err)
+		}
+		if _, found, err := sessions.GetAs[string](session, "missing"); found || err != nil {
+			t.Error("Typed reading of a missing key failed:", found, err)
+		}
+		if _, found, err := sessions.GetAs[int](session, "key"); !found || err == nil {
+			t.Error("Expected an error reading a string as int")
+		}
+		c.String(http.StatusOK, ok)
+	})
+
+	w1 := ut.PerformRequest(r, consts.MethodGet, "/set", nil)
+	_ = ut.PerformRequest(r, consts.MethodGet, "/get", nil, ut.Header{
+		Key:   "Cookie",
+		Value: strings.Join(adaptor.GetCompatResponseWriter(w1.Result()).Header().Values("Set-Cookie"), "; "),
+	})
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2023 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sessions
+
+import (
+	"strings"
+
+	"github.com/gorilla/sessions"
+)
+
+// Transport carries the encoded session ID, the token, between the client
+// and the stores keeping the sessions server-side, see RediStore.SetTransport.
+// The token is sent in a cookie by default, CookieTransport.
+type Transport interface {
+	// Token returns the token sent by the client for the session name.
+	Token(c Carrier, name string) (string, bool)
+	// SetToken sends the token of the session name to the client. An empty
+	// token tells the client to drop it.
+	SetToken(c Carrier, name, token string, options *sessions.Options)
+}
+
+// CookieTransport carries the token in the cookie named after the session.
+type CookieTransport struct{}
+
+// Token reads the session cookie
+func (CookieTransport) Token(c Carrier, name string) (string, bool) {
+	return c.Cookie(name)
+}
+
+// SetToken sets the session cookie with the options of the session
+func (CookieTransport) SetToken(c Carrier, name, token string, options *sessions.Options) {
+	c.SetCookie(sessions.NewCookie(name, token, options))
+}
+
+// HeaderTransport carries the token in a request header, e.g. for mobile
+// clients, and sends it back in a response header. Browser clients reading it
+// across origins need it listed in Access-Control-Expose-Headers.
+type HeaderTransport struct {
+	// Header is the request header holding the token, e.g. "X-Session-Token".
+	Header string
+	// Scheme is the authentication scheme before the token, e.g. "Bearer"
+	// for the Authorization header. Headers of another scheme are ignored.
+	Scheme string
+	// ResponseHeader is the response header the token is sent in,
+	// Header if empty.
+	ResponseHeader string
+}
+
+// Token reads the request header, without the scheme
+func (t HeaderTransport) Token(c Carrier, _ string) (string, bool) {
+	v := strings.TrimSpace(c.Header(t.Header))
+	if t.Scheme != "" {
+		// the scheme is case-insensitive, see RFC 7235
+		if len(v) <= len(t.Scheme) || !strings.EqualFold(v[:len(t.Scheme)], t.Scheme) || v[len(t.Scheme)] != ' ' {
+			return "", false
+		}
+		v = strings.TrimSpace(v[len(t.Scheme):])
+	}
+	return v, v != ""
+}
+
+// SetToken sets the response header, without the scheme
+func (t HeaderTransport) SetToken(c Carrier, _, token string, _ *sessions.Options) {
+	header := t.ResponseHeader
+	if header == "" {
+		header = t.Header
+	}
+	c.SetHeader(header, token)
+}
+
+// QueryTransport reads the token from a query parameter, e.g. for WebSocket
+// clients unable to set headers. The token is never sent back in a URL,
+// chain it with another transport to send it.
+type QueryTransport struct {
+	// Param is the query parameter holding the token.
+	Param string
+}
+
+// Token reads the query parameter
+func (t QueryTransport) Token(c Carrier, _ string) (string, bool) {
+	v := c.Query(t.Param)
+	return v, v != ""
+}
+
+// SetToken does nothing, the token is not sent back
+func (QueryTransport) SetToken(Carrier, string, string, *sessions.Options) {}
+
+// ChainTransport reads the token from the first transport the client sent it
+// with, and sends it with all of them: the same session then serves browsers
+// and API clients.
+//
+//	ChainTransport{CookieTransport{}, HeaderTransport{Header: "Authorization", Scheme: "Bearer", ResponseHeader: "X-Session-Token"}}
+type ChainTransport []Transport
+
+// Token returns the token of the first transport finding one
+func (t ChainTransport) Token(c Carrier, name string) (string, bool) {
+	for _, tt := range t {
+		if token, ok := tt.Token(c, name); ok {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// SetToken sends the token with all the transports
+func (t ChainTransport) SetToken(c Carrier, name, token string, options *sessions.Options) {
+	for _, tt := range t {
+		tt.SetToken(c, name, token, options)
+	}
+}